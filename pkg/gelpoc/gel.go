@@ -3,10 +3,13 @@ package gelpoc
 import (
 	"context"
 	"fmt"
+	"math"
 	"strings"
+	"time"
 
 	"github.com/grafana/gel-app/pkg/mathexp"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
 // Command is an interface for all GEL commands.
@@ -15,10 +18,18 @@ type Command interface {
 	Execute(c context.Context, vars mathexp.Vars) (mathexp.Results, error)
 }
 
+// noticeCommand is a Command whose results can have notices. The notices are kept
+// even if there are no results, so the user can see why.
+type noticeCommand interface {
+	Command
+	ExecuteWithNotices(c context.Context, vars mathexp.Vars) (mathexp.Results, []data.Notice, error)
+}
+
 // MathCommand is a GEL commad for a GEL math expression such as "1 + $GA / 2"
 type MathCommand struct {
 	RawExpression string
 	Expression    *mathexp.Expr
+	Options       mathexp.Options
 }
 
 // NewMathCommand creates a new MathCommand. It will return an error
@@ -49,9 +60,54 @@ func UnmarshalMathCommand(rn *rawNode) (*MathCommand, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid math command type in '%v': %v", rn.RefID, err)
 	}
+
+	if rawJoin, ok := rn.Query["join"]; ok {
+		join, ok := rawJoin.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected join to be a string, got %T for refId %v", rawJoin, rn.RefID)
+		}
+		if gm.Options.Join, err = mathexp.ParseJoinMode(join); err != nil {
+			return nil, fmt.Errorf("invalid join in '%v': %v", rn.RefID, err)
+		}
+	}
+
+	if rawTolerance, ok := rn.Query["joinTolerance"]; ok {
+		tolerance, ok := rawTolerance.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected joinTolerance to be a string, got %T for refId %v", rawTolerance, rn.RefID)
+		}
+		if gm.Options.JoinTolerance, err = time.ParseDuration(tolerance); err != nil {
+			return nil, fmt.Errorf("invalid joinTolerance in '%v': %v", rn.RefID, err)
+		}
+	}
+
+	if gm.Options.NullMode, err = unmarshalNullMode(rn); err != nil {
+		return nil, err
+	}
+
+	if gm.Options.Location, err = unmarshalTimezone(rn); err != nil {
+		return nil, err
+	}
 	return gm, nil
 }
 
+// unmarshalNullMode reads the optional null mode of a command from Grafana's frontend query.
+func unmarshalNullMode(rn *rawNode) (mathexp.NullMode, error) {
+	rawNullMode, ok := rn.Query["nullMode"]
+	if !ok {
+		return mathexp.NullModeDefault, nil
+	}
+	nullMode, ok := rawNullMode.(string)
+	if !ok {
+		return mathexp.NullModeDefault, fmt.Errorf("expected nullMode to be a string, got %T for refId %v", rawNullMode, rn.RefID)
+	}
+	m, err := mathexp.ParseNullMode(nullMode)
+	if err != nil {
+		return mathexp.NullModeDefault, fmt.Errorf("invalid nullMode in '%v': %v", rn.RefID, err)
+	}
+	return m, nil
+}
+
 // NeedsVars returns the variable names (refIds) that are dependencies
 // to execute the command and allows the command to fulfill the Command interface.
 func (gm *MathCommand) NeedsVars() []string {
@@ -59,15 +115,34 @@ func (gm *MathCommand) NeedsVars() []string {
 }
 
 // Execute runs the command and returns the results or an error if the command
-// failed to execute.
+// failed to execute. In a range evaluation the time function returns the time of
+// the step.
 func (gm *MathCommand) Execute(ctx context.Context, vars mathexp.Vars) (mathexp.Results, error) {
-	return gm.Expression.Execute(vars)
+	res, _, err := gm.ExecuteWithNotices(ctx, vars)
+	return res, err
+}
+
+// ExecuteWithNotices is like Execute, but also returns notices about the results, such
+// as binary operations with results that were dropped because their labels do not match.
+func (gm *MathCommand) ExecuteWithNotices(ctx context.Context, vars mathexp.Vars) (mathexp.Results, []data.Notice, error) {
+	opts := gm.Options
+	if tr, ok := stepRange(ctx); ok {
+		opts.Now = tr.To
+	}
+	return gm.Expression.ExecuteWithNotices(vars, opts)
 }
 
 // ReduceCommand is a GEL command for reduction of a timeseries such as a min, mean, or max.
 type ReduceCommand struct {
 	Reducer     string
 	VarToReduce string
+	// NullMode is how null values are reduced, see mathexp.Series.ReduceWithNullMode.
+	NullMode mathexp.NullMode
+	// Mapper changes each series before it is reduced, such as to drop or replace null
+	// and NaN values. It is nil in the "strict" mode, where each series is reduced as is.
+	// If both a Mapper and a NullMode are set, the Mapper is applied first and the
+	// NullMode applies to any null values left.
+	Mapper mathexp.ReduceMapper
 }
 
 // NewReduceCommand creates a new ReduceCMD.
@@ -100,7 +175,38 @@ func UnmarshalReduceCommand(rn *rawNode) (*ReduceCommand, error) {
 		return nil, fmt.Errorf("expected reducer to be a string, got %T for refId %v", rawReducer, rn.RefID)
 	}
 
-	return NewReduceCommand(redFunc, varToReduce), nil
+	gr := NewReduceCommand(redFunc, varToReduce)
+	var err error
+	if gr.NullMode, err = unmarshalNullMode(rn); err != nil {
+		return nil, err
+	}
+
+	var mode string
+	if rawMode, ok := rn.Query["mode"]; ok {
+		if mode, ok = rawMode.(string); !ok {
+			return nil, fmt.Errorf("expected mode to be a string, got %T for refId %v", rawMode, rn.RefID)
+		}
+	}
+	var replaceWith float64
+	if mode == "replaceNN" {
+		rawReplace, ok := rn.Query["replaceWithValue"]
+		if !ok {
+			return nil, fmt.Errorf("no replaceWithValue specified for mode replaceNN in gel command for refId %v", rn.RefID)
+		}
+		if replaceWith, ok = rawReplace.(float64); !ok {
+			return nil, fmt.Errorf("expected replaceWithValue to be a number, got %T for refId %v", rawReplace, rn.RefID)
+		}
+	}
+	if gr.Mapper, err = mathexp.ParseReduceMapper(mode, replaceWith); err != nil {
+		return nil, fmt.Errorf("invalid mode in '%v': %v", rn.RefID, err)
+	}
+	// Each mode decides how null values are reduced: "strict" reduces them as they
+	// are, and "dropNN" and "replaceNN" remove them. So a mode is only used on its own,
+	// and the null mode is only used without one.
+	if mode != "" && gr.NullMode != mathexp.NullModeDefault {
+		return nil, fmt.Errorf("mode %v can not be used with nullMode %v in gel command for refId %v", mode, gr.NullMode, rn.RefID)
+	}
+	return gr, nil
 }
 
 // NeedsVars returns the variable names (refIds) that are dependencies
@@ -118,7 +224,10 @@ func (gr *ReduceCommand) Execute(ctx context.Context, vars mathexp.Vars) (mathex
 		if !ok {
 			return newRes, fmt.Errorf("can only reduce type series, got type %v", val.Type())
 		}
-		num, err := series.Reduce(gr.Reducer)
+		if gr.Mapper != nil {
+			series = gr.Mapper.MapInput(series)
+		}
+		num, err := series.ReduceWithNullMode(gr.Reducer, gr.NullMode)
 		if err != nil {
 			return newRes, err
 		}
@@ -134,6 +243,7 @@ type ResampleCommand struct {
 	Downsampler   string
 	Upsampler     string
 	TimeRange     backend.TimeRange
+	Options       mathexp.ResampleOptions
 }
 
 // NewResampleCommand creates a new ResampleCMD.
@@ -169,6 +279,12 @@ func UnmarshalResampleCommand(rn *rawNode) (*ResampleCommand, error) {
 	if !ok {
 		return nil, fmt.Errorf("expected reducer to be a string, got %T for refId %v", rawRule, rn.RefID)
 	}
+	if rule == "auto" {
+		var err error
+		if rule, err = autoResampleRule(rn); err != nil {
+			return nil, err
+		}
+	}
 
 	rawDownsampler, ok := rn.Query["downsampler"]
 	if !ok {
@@ -187,7 +303,59 @@ func UnmarshalResampleCommand(rn *rawNode) (*ResampleCommand, error) {
 	if !ok {
 		return nil, fmt.Errorf("expected downsampler to be a string, got %T for refId %v", upsampler, rn.RefID)
 	}
-	return NewResampleCommand(rule, varToResample, downsampler, upsampler, rn.TimeRange), nil
+	gr := NewResampleCommand(rule, varToResample, downsampler, upsampler, rn.TimeRange)
+
+	if rawAlign, ok := rn.Query["align"]; ok {
+		if gr.Options.Align, ok = rawAlign.(bool); !ok {
+			return nil, fmt.Errorf("expected align to be a bool, got %T for refId %v", rawAlign, rn.RefID)
+		}
+	}
+
+	loc, err := unmarshalTimezone(rn)
+	if err != nil {
+		return nil, err
+	}
+	gr.Options.Location = loc
+	return gr, nil
+}
+
+// unmarshalTimezone reads the optional timezone of a command from Grafana's frontend
+// query. It returns nil if there is no timezone.
+func unmarshalTimezone(rn *rawNode) (*time.Location, error) {
+	rawTimezone, ok := rn.Query["timezone"]
+	if !ok {
+		return nil, nil
+	}
+	timezone, ok := rawTimezone.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected timezone to be a string, got %T for refId %v", rawTimezone, rn.RefID)
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone in '%v': %v", rn.RefID, err)
+	}
+	return loc, nil
+}
+
+// autoResampleRule returns the resample rule for the "auto" rule, computed from the
+// time range and the optional intervalMs and maxDataPoints of the query.
+func autoResampleRule(rn *rawNode) (string, error) {
+	intervalMS, maxDP := defaultIntervalMS, defaultMaxDP
+	if rawIntervalMS, ok := rn.Query["intervalMs"]; ok {
+		floatIntervalMS, ok := rawIntervalMS.(float64)
+		if !ok {
+			return "", fmt.Errorf("expected intervalMs to be an float64, got %T for refId %v", rawIntervalMS, rn.RefID)
+		}
+		intervalMS = int64(floatIntervalMS)
+	}
+	if rawMaxDP, ok := rn.Query["maxDataPoints"]; ok {
+		floatMaxDP, ok := rawMaxDP.(float64)
+		if !ok {
+			return "", fmt.Errorf("expected maxDataPoints to be an float64, got %T for refId %v", rawMaxDP, rn.RefID)
+		}
+		maxDP = int64(floatMaxDP)
+	}
+	return mathexp.AutoRule(rn.TimeRange, time.Duration(intervalMS)*time.Millisecond, maxDP), nil
 }
 
 // NeedsVars returns the variable names (refIds) that are dependencies
@@ -197,15 +365,20 @@ func (gr *ResampleCommand) NeedsVars() []string {
 }
 
 // Execute runs the command and returns the results or an error if the command
-// failed to execute.
+// failed to execute. In a range evaluation the series are resampled over the
+// lookback window of the step instead of the time range of the query.
 func (gr *ResampleCommand) Execute(ctx context.Context, vars mathexp.Vars) (mathexp.Results, error) {
+	tr := gr.TimeRange
+	if stepTR, ok := stepRange(ctx); ok {
+		tr = stepTR
+	}
 	newRes := mathexp.Results{}
 	for _, val := range vars[gr.VarToResample].Values {
 		series, ok := val.(mathexp.Series)
 		if !ok {
 			return newRes, fmt.Errorf("can only resample type series, got type %v", val.Type())
 		}
-		num, err := series.Resample(gr.Rule, gr.Downsampler, gr.Upsampler, gr.TimeRange)
+		num, err := series.ResampleWithOptions(gr.Rule, gr.Downsampler, gr.Upsampler, tr, gr.Options)
 		if err != nil {
 			return newRes, err
 		}
@@ -214,6 +387,325 @@ func (gr *ResampleCommand) Execute(ctx context.Context, vars mathexp.Vars) (math
 	return newRes, nil
 }
 
+// ForCommand is a GEL command that evaluates if a condition (a series of true/false
+// values such as the result of "$A > 90") has held for a duration or number of points.
+type ForCommand struct {
+	Window     mathexp.Window
+	VarToCheck string
+}
+
+// NewForCommand creates a new ForCommand. It will return an error
+// if window is not a valid duration or number of points.
+func NewForCommand(window, varToCheck string) (*ForCommand, error) {
+	w, err := mathexp.ParseWindow(window)
+	if err != nil {
+		return nil, err
+	}
+	return &ForCommand{
+		Window:     w,
+		VarToCheck: varToCheck,
+	}, nil
+}
+
+// UnmarshalForCommand creates a ForCommand from Grafana's frontend query.
+func UnmarshalForCommand(rn *rawNode) (*ForCommand, error) {
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("no variable to evaluate in gel command for refId %v", rn.RefID)
+	}
+	varToCheck, ok := rawVar.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected variable to be a string, got %T for refId %v", rawVar, rn.RefID)
+	}
+	varToCheck = strings.TrimPrefix(varToCheck, "$")
+
+	rawWindow, ok := rn.Query["for"]
+	if !ok {
+		return nil, fmt.Errorf("no duration specified in gel command for refId %v", rn.RefID)
+	}
+	window, ok := rawWindow.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected duration to be a string, got %T for refId %v", rawWindow, rn.RefID)
+	}
+
+	fc, err := NewForCommand(window, varToCheck)
+	if err != nil {
+		return nil, fmt.Errorf("invalid for command in '%v': %v", rn.RefID, err)
+	}
+	return fc, nil
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (fc *ForCommand) NeedsVars() []string {
+	return []string{fc.VarToCheck}
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute. There is one Number per input series, which is 1 if the
+// condition held for the window as of the last point of the series, and 0 otherwise.
+func (fc *ForCommand) Execute(ctx context.Context, vars mathexp.Vars) (mathexp.Results, error) {
+	newRes := mathexp.Results{}
+	for _, val := range vars[fc.VarToCheck].Values {
+		series, ok := val.(mathexp.Series)
+		if !ok {
+			return newRes, fmt.Errorf("can only evaluate for on type series, got type %v", val.Type())
+		}
+		newRes.Values = append(newRes.Values, series.ForNumber(fc.Window))
+	}
+	return newRes, nil
+}
+
+// FilterCommand is a GEL command that keeps only the results whose labels
+// match a set of label matchers such as host=~"web-.*".
+type FilterCommand struct {
+	Matchers    mathexp.Matchers
+	VarToFilter string
+}
+
+// NewFilterCommand creates a new FilterCommand. It will return an error
+// if matchers can not be parsed.
+func NewFilterCommand(matchers, varToFilter string) (*FilterCommand, error) {
+	ms, err := mathexp.ParseMatchers(matchers)
+	if err != nil {
+		return nil, err
+	}
+	return &FilterCommand{
+		Matchers:    ms,
+		VarToFilter: varToFilter,
+	}, nil
+}
+
+// UnmarshalFilterCommand creates a FilterCommand from Grafana's frontend query.
+func UnmarshalFilterCommand(rn *rawNode) (*FilterCommand, error) {
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("no variable to filter in gel command for refId %v", rn.RefID)
+	}
+	varToFilter, ok := rawVar.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected variable to be a string, got %T for refId %v", rawVar, rn.RefID)
+	}
+	varToFilter = strings.TrimPrefix(varToFilter, "$")
+
+	rawMatchers, ok := rn.Query["matchers"]
+	if !ok {
+		return nil, fmt.Errorf("no matchers specified in gel command for refId %v", rn.RefID)
+	}
+	matchers, ok := rawMatchers.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected matchers to be a string, got %T for refId %v", rawMatchers, rn.RefID)
+	}
+
+	fc, err := NewFilterCommand(matchers, varToFilter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter command in '%v': %v", rn.RefID, err)
+	}
+	return fc, nil
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (fc *FilterCommand) NeedsVars() []string {
+	return []string{fc.VarToFilter}
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute.
+func (fc *FilterCommand) Execute(ctx context.Context, vars mathexp.Vars) (mathexp.Results, error) {
+	return vars[fc.VarToFilter].Filter(fc.Matchers), nil
+}
+
+// AggregateCommand is a GEL command for aggregating across series or numbers,
+// such as the sum of all series by host.
+type AggregateCommand struct {
+	Aggregator     mathexp.Aggregator
+	Grouping       mathexp.Grouping
+	VarToAggregate string
+	NullMode       mathexp.NullMode
+}
+
+// NewAggregateCommand creates a new AggregateCommand. It will return an error
+// if the aggregator or grouping are not valid.
+func NewAggregateCommand(aggregator, grouping, varToAggregate string) (*AggregateCommand, error) {
+	agg, err := mathexp.ParseAggregator(aggregator)
+	if err != nil {
+		return nil, err
+	}
+	g, err := mathexp.ParseGrouping(grouping)
+	if err != nil {
+		return nil, err
+	}
+	return &AggregateCommand{
+		Aggregator:     agg,
+		Grouping:       g,
+		VarToAggregate: varToAggregate,
+	}, nil
+}
+
+// UnmarshalAggregateCommand creates an AggregateCommand from Grafana's frontend query.
+// The grouping is optional, and if missing all results are aggregated together.
+func UnmarshalAggregateCommand(rn *rawNode) (*AggregateCommand, error) {
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("no variable to aggregate in gel command for refId %v", rn.RefID)
+	}
+	varToAggregate, ok := rawVar.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected variable to be a string, got %T for refId %v", rawVar, rn.RefID)
+	}
+	varToAggregate = strings.TrimPrefix(varToAggregate, "$")
+
+	rawAggregator, ok := rn.Query["aggregator"]
+	if !ok {
+		return nil, fmt.Errorf("no aggregator specified in gel command for refId %v", rn.RefID)
+	}
+	aggregator, ok := rawAggregator.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected aggregator to be a string, got %T for refId %v", rawAggregator, rn.RefID)
+	}
+
+	var grouping string
+	if rawGrouping, ok := rn.Query["grouping"]; ok {
+		if grouping, ok = rawGrouping.(string); !ok {
+			return nil, fmt.Errorf("expected grouping to be a string, got %T for refId %v", rawGrouping, rn.RefID)
+		}
+	}
+
+	ac, err := NewAggregateCommand(aggregator, grouping, varToAggregate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid aggregate command in '%v': %v", rn.RefID, err)
+	}
+	if ac.NullMode, err = unmarshalNullMode(rn); err != nil {
+		return nil, err
+	}
+	return ac, nil
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (ac *AggregateCommand) NeedsVars() []string {
+	return []string{ac.VarToAggregate}
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute.
+func (ac *AggregateCommand) Execute(ctx context.Context, vars mathexp.Vars) (mathexp.Results, error) {
+	return vars[ac.VarToAggregate].AggregateWithNullMode(ac.Aggregator, ac.Grouping, ac.NullMode)
+}
+
+// TopKCommand is a GEL command for selecting the k series or numbers with the
+// greatest or least rank, such as the top 10 hosts by mean CPU.
+type TopKCommand struct {
+	K        int
+	Reducer  string
+	Bottom   bool
+	VarToTop string
+	NullMode mathexp.NullMode
+	// Other aggregates the values that are not selected into one more value
+	// labelled __other__. It is nil if there is no such value.
+	Other *mathexp.Aggregator
+}
+
+// NewTopKCommand creates a new TopKCommand.
+func NewTopKCommand(k int, reducer string, bottom bool, varToTop string) *TopKCommand {
+	return &TopKCommand{
+		K:        k,
+		Reducer:  reducer,
+		Bottom:   bottom,
+		VarToTop: varToTop,
+	}
+}
+
+// UnmarshalTopKCommand creates a TopKCommand from Grafana's frontend query.
+// bottom is optional and selects the least ranked values when true. other is
+// optional and is the aggregator (e.g. "sum") of the values that are not selected.
+func UnmarshalTopKCommand(rn *rawNode) (*TopKCommand, error) {
+	rawVar, ok := rn.Query["expression"]
+	if !ok {
+		return nil, fmt.Errorf("no variable to rank in gel command for refId %v", rn.RefID)
+	}
+	varToTop, ok := rawVar.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected variable to be a string, got %T for refId %v", rawVar, rn.RefID)
+	}
+	varToTop = strings.TrimPrefix(varToTop, "$")
+
+	rawK, ok := rn.Query["k"]
+	if !ok {
+		return nil, fmt.Errorf("no k specified in gel command for refId %v", rn.RefID)
+	}
+	k, ok := rawK.(float64)
+	if !ok {
+		return nil, fmt.Errorf("expected k to be a number, got %T for refId %v", rawK, rn.RefID)
+	}
+	if k < 0 || k != math.Trunc(k) {
+		return nil, fmt.Errorf("expected k to be a non-negative integer, got %v for refId %v", k, rn.RefID)
+	}
+
+	rawReducer, ok := rn.Query["reducer"]
+	if !ok {
+		return nil, fmt.Errorf("no reducer specified in gel command for refId %v", rn.RefID)
+	}
+	reducer, ok := rawReducer.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected reducer to be a string, got %T for refId %v", rawReducer, rn.RefID)
+	}
+
+	var bottom bool
+	if rawBottom, ok := rn.Query["bottom"]; ok {
+		if bottom, ok = rawBottom.(bool); !ok {
+			return nil, fmt.Errorf("expected bottom to be a bool, got %T for refId %v", rawBottom, rn.RefID)
+		}
+	}
+
+	// TopK selects at most all the values, so a larger k is the same as MaxInt32
+	// and does not overflow an int.
+	tc := NewTopKCommand(int(math.Min(k, math.MaxInt32)), reducer, bottom, varToTop)
+
+	if rawOther, ok := rn.Query["other"]; ok {
+		other, ok := rawOther.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected other to be a string, got %T for refId %v", rawOther, rn.RefID)
+		}
+		agg, err := mathexp.ParseAggregator(other)
+		if err != nil {
+			return nil, fmt.Errorf("invalid other in '%v': %v", rn.RefID, err)
+		}
+		tc.Other = &agg
+	}
+
+	var err error
+	if tc.NullMode, err = unmarshalNullMode(rn); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+// NeedsVars returns the variable names (refIds) that are dependencies
+// to execute the command and allows the command to fulfill the Command interface.
+func (tc *TopKCommand) NeedsVars() []string {
+	return []string{tc.VarToTop}
+}
+
+// Execute runs the command and returns the results or an error if the command
+// failed to execute.
+func (tc *TopKCommand) Execute(ctx context.Context, vars mathexp.Vars) (mathexp.Results, error) {
+	selected, rest, err := vars[tc.VarToTop].TopK(tc.K, tc.Reducer, tc.Bottom, tc.NullMode)
+	if err != nil {
+		return selected, err
+	}
+	if tc.Other == nil || len(rest.Values) == 0 {
+		return selected, nil
+	}
+	other, err := rest.Other(*tc.Other, tc.NullMode)
+	if err != nil {
+		return selected, err
+	}
+	selected.Values = append(selected.Values, other.Values...)
+	return selected, nil
+}
+
 // CommandType is the type of GelCommand.
 type CommandType int
 
@@ -226,6 +718,14 @@ const (
 	TypeReduce
 	// TypeResample is the CMDType for a GEL resampling function.
 	TypeResample
+	// TypeFor is the CMDType for a GEL for duration evaluation.
+	TypeFor
+	// TypeFilter is the CMDType for a GEL label filter.
+	TypeFilter
+	// TypeAggregate is the CMDType for a GEL aggregation across series.
+	TypeAggregate
+	// TypeTopK is the CMDType for a GEL top-k or bottom-k selection.
+	TypeTopK
 )
 
 func (gt CommandType) String() string {
@@ -236,6 +736,14 @@ func (gt CommandType) String() string {
 		return "reduce"
 	case TypeResample:
 		return "resample"
+	case TypeFor:
+		return "for"
+	case TypeFilter:
+		return "filter"
+	case TypeAggregate:
+		return "aggregate"
+	case TypeTopK:
+		return "topk"
 	default:
 		return "unknown"
 	}
@@ -250,6 +758,14 @@ func ParseCommandType(s string) (CommandType, error) {
 		return TypeReduce, nil
 	case "resample":
 		return TypeResample, nil
+	case "for":
+		return TypeFor, nil
+	case "filter":
+		return TypeFilter, nil
+	case "aggregate":
+		return TypeAggregate, nil
+	case "topk":
+		return TypeTopK, nil
 	default:
 		return TypeUnknown, fmt.Errorf("'%v' is not a GEL Type", s)
 	}
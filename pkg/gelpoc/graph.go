@@ -7,6 +7,7 @@ import (
 
 	"github.com/grafana/gel-app/pkg/mathexp"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 
 	"gonum.org/v1/gonum/graph"
 	"gonum.org/v1/gonum/graph/simple"
@@ -36,18 +37,35 @@ type Node interface {
 type DataPipeline []Node
 
 // execute runs all the command/datasource requests in the pipeline return a
-// map of the refId of the of each command
-func (dp *DataPipeline) execute(c context.Context) (mathexp.Vars, error) {
+// map of the refId of the of each command, and a map of the refId of each
+// command to the notices of its results.
+func (dp *DataPipeline) execute(c context.Context) (mathexp.Vars, map[string][]data.Notice, error) {
 	vars := make(mathexp.Vars)
+	notices := make(map[string][]data.Notice)
 	for _, node := range *dp {
-		res, err := node.Execute(c, vars)
+		res, n, err := executeNode(c, node, vars)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		vars[node.RefID()] = res
+		if len(n) != 0 {
+			notices[node.RefID()] = n
+		}
+	}
+	return vars, notices, nil
+}
+
+// executeNode runs the node and returns its results, and their notices if the node
+// is a GEL command that has them.
+func executeNode(c context.Context, node Node, vars mathexp.Vars) (mathexp.Results, []data.Notice, error) {
+	if gn, ok := node.(*GELNode); ok {
+		if nc, ok := gn.GELCommand.(noticeCommand); ok {
+			return nc.ExecuteWithNotices(c, vars)
+		}
 	}
-	return vars, nil
+	res, err := node.Execute(c, vars)
+	return res, nil, err
 }
 
 const gelNodeName = "__expr__"
@@ -106,6 +106,14 @@ func buildGELNode(dp *simple.DirectedGraph, rn *rawNode) (*GELNode, error) {
 		node.GELCommand, err = UnmarshalReduceCommand(rn)
 	case TypeResample:
 		node.GELCommand, err = UnmarshalResampleCommand(rn)
+	case TypeFor:
+		node.GELCommand, err = UnmarshalForCommand(rn)
+	case TypeFilter:
+		node.GELCommand, err = UnmarshalFilterCommand(rn)
+	case TypeAggregate:
+		node.GELCommand, err = UnmarshalAggregateCommand(rn)
+	case TypeTopK:
+		node.GELCommand, err = UnmarshalTopKCommand(rn)
 	default:
 		return nil, fmt.Errorf("gel type '%v' in '%v' not implemented", commandType, rn.RefID)
 	}
@@ -131,7 +139,10 @@ type DSNode struct {
 	timeRange    backend.TimeRange
 	intervalMS   int64
 	maxDP        int64
-	callBack     backend.TransformDataCallBackHandler
+	// timeShift moves the time range of the query back, and the times of the
+	// returned series forward, so the results line up with unshifted queries.
+	timeShift time.Duration
+	callBack  backend.TransformDataCallBackHandler
 }
 
 // NodeType returns the data pipeline node type.
@@ -194,6 +205,16 @@ func buildDSNode(dp *simple.DirectedGraph, rn *rawNode, callBack backend.Transfo
 		dsNode.maxDP = int64(floatMaxDP)
 	}
 
+	if rawTimeShift, ok := rn.Query["timeShift"]; ok {
+		timeShift, ok := rawTimeShift.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected timeShift to be a string, got %T for refId %v", rawTimeShift, rn.RefID)
+		}
+		if dsNode.timeShift, err = mathexp.ParseDuration(timeShift); err != nil {
+			return nil, fmt.Errorf("invalid timeShift for refId %v: %w", rn.RefID, err)
+		}
+	}
+
 	return dsNode, nil
 }
 
@@ -215,8 +236,11 @@ func (dn *DSNode) Execute(ctx context.Context, vars mathexp.Vars) (mathexp.Resul
 			MaxDataPoints: dn.maxDP,
 			Interval:      time.Duration(int64(time.Millisecond) * dn.intervalMS),
 			JSON:          dn.query,
-			TimeRange:     dn.timeRange,
-			QueryType:     dn.queryType,
+			TimeRange: backend.TimeRange{
+				From: dn.timeRange.From.Add(-dn.timeShift),
+				To:   dn.timeRange.To.Add(-dn.timeShift),
+			},
+			QueryType: dn.queryType,
 		},
 	}
 
@@ -237,6 +261,9 @@ func (dn *DSNode) Execute(ctx context.Context, vars mathexp.Vars) (mathexp.Resul
 				return mathexp.Results{}, err
 			}
 			for _, s := range series {
+				if dn.timeShift != 0 {
+					s = s.TimeShift(dn.timeShift)
+				}
 				vals = append(vals, s)
 			}
 		}
@@ -0,0 +1,268 @@
+package gelpoc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/gel-app/pkg/mathexp"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// RangeOptions are the steps at which a pipeline is evaluated by ExecutePipelineRange.
+type RangeOptions struct {
+	// From and To are the times of the first and last steps.
+	From, To time.Time
+	// Step is the time between steps.
+	Step time.Duration
+	// Lookback is how far back from each step the datasource data is seen
+	// by the GEL nodes.
+	Lookback time.Duration
+}
+
+// MaxRangeSteps is the maximum number of steps of a range evaluation, so that a long
+// range with a small step does not run the GEL nodes millions of times.
+const MaxRangeSteps = 11000
+
+// validate returns an error if the options do not give at least one step, or if
+// they give more than MaxRangeSteps steps.
+func (o RangeOptions) validate() error {
+	if o.Step <= 0 {
+		return fmt.Errorf("range step must be positive, got %v", o.Step)
+	}
+	if o.Lookback <= 0 {
+		return fmt.Errorf("range lookback must be positive, got %v", o.Lookback)
+	}
+	if o.To.Before(o.From) {
+		return fmt.Errorf("range ends before it starts")
+	}
+	if steps := int64(o.To.Sub(o.From)/o.Step) + 1; steps > MaxRangeSteps {
+		return fmt.Errorf("range has %v steps, more than the maximum of %v, use a larger step", steps, MaxRangeSteps)
+	}
+	return nil
+}
+
+// RangeOptionsFromQueries returns the RangeOptions of a request from Grafana's frontend,
+// or nil if the request is not for a range evaluation. A GEL query asks for a range
+// evaluation with a "range" property that has the "step" and "lookback" durations, and
+// the steps are from the start to the end of the time range of the query. The whole
+// pipeline is evaluated over the range, so it is an error for GEL queries to have
+// different ranges.
+func RangeOptionsFromQueries(queries []backend.DataQuery) (*RangeOptions, error) {
+	var opts *RangeOptions
+	for _, query := range queries {
+		rq := struct {
+			Datasource string `json:"datasource"`
+			Range      *struct {
+				Step     string `json:"step"`
+				Lookback string `json:"lookback"`
+			} `json:"range"`
+		}{}
+		if err := json.Unmarshal(query.JSON, &rq); err != nil {
+			return nil, err
+		}
+		if rq.Datasource != gelNodeName || rq.Range == nil {
+			continue
+		}
+		step, err := mathexp.ParseDuration(rq.Range.Step)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range step for refId %v: %w", query.RefID, err)
+		}
+		lookback, err := mathexp.ParseDuration(rq.Range.Lookback)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range lookback for refId %v: %w", query.RefID, err)
+		}
+		o := RangeOptions{From: query.TimeRange.From, To: query.TimeRange.To, Step: step, Lookback: lookback}
+		if err := o.validate(); err != nil {
+			return nil, fmt.Errorf("invalid range for refId %v: %w", query.RefID, err)
+		}
+		if opts != nil && (!o.From.Equal(opts.From) || !o.To.Equal(opts.To) || o.Step != opts.Step || o.Lookback != opts.Lookback) {
+			return nil, fmt.Errorf("range of refId %v is different from the range of other queries", query.RefID)
+		}
+		opts = &o
+	}
+	return opts, nil
+}
+
+// executeRange runs the datasource nodes of the pipeline once over the range and the
+// lookback before it, and then runs the GEL nodes at each step of the range as if it
+// were the current time. At each step the GEL nodes see the datasource series within
+// the lookback window up to the step, resample over that window, and the time function
+// returns the time of the step.
+//
+// The results of the datasource nodes are returned unchanged. The results of the
+// GEL nodes are stitched into a Series per refId and label set, with a point for
+// each step at which the node returned a value with those labels. A Number or Scalar
+// gives its value, and a Series gives the value of its last point. The notices of the
+// GEL nodes are returned once per refId, however many steps they were returned at.
+func (dp *DataPipeline) executeRange(c context.Context, opts RangeOptions) (mathexp.Vars, map[string][]data.Notice, error) {
+	if err := opts.validate(); err != nil {
+		return nil, nil, err
+	}
+	dsVars := make(mathexp.Vars)
+	for _, node := range *dp {
+		dn, ok := node.(*DSNode)
+		if !ok {
+			continue
+		}
+		rangeNode := *dn
+		rangeNode.timeRange = backend.TimeRange{From: opts.From.Add(-opts.Lookback), To: opts.To}
+		res, err := rangeNode.Execute(c, dsVars)
+		if err != nil {
+			return nil, nil, err
+		}
+		dsVars[node.RefID()] = res
+	}
+
+	stitched := make(map[string]*stitcher)
+	notices := make(map[string][]data.Notice)
+	for step := opts.From; !step.After(opts.To); step = step.Add(opts.Step) {
+		vars := make(mathexp.Vars, len(*dp))
+		for refID, res := range dsVars {
+			vars[refID] = lookback(res, step.Add(-opts.Lookback), step)
+		}
+		for _, node := range *dp {
+			if node.NodeType() == TypeDatasourceNode {
+				continue
+			}
+			res, n, err := executeNode(withStep(c, backend.TimeRange{From: step.Add(-opts.Lookback), To: step}), node, vars)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to evaluate %v at %v: %w", node.RefID(), step, err)
+			}
+			vars[node.RefID()] = res
+			notices[node.RefID()] = appendNewNotices(notices[node.RefID()], n)
+			st, ok := stitched[node.RefID()]
+			if !ok {
+				st = newStitcher()
+				stitched[node.RefID()] = st
+			}
+			st.add(step, res)
+		}
+	}
+
+	vars := dsVars
+	for refID, st := range stitched {
+		vars[refID] = st.results()
+	}
+	return vars, notices, nil
+}
+
+// appendNewNotices appends the notices of newNotices that are not already in notices.
+func appendNewNotices(notices, newNotices []data.Notice) []data.Notice {
+	for _, n := range newNotices {
+		found := false
+		for _, existing := range notices {
+			if existing == n {
+				found = true
+				break
+			}
+		}
+		if !found {
+			notices = append(notices, n)
+		}
+	}
+	return notices
+}
+
+// stepKey is the context key of the lookback window of a step of a range evaluation.
+type stepKey struct{}
+
+// withStep returns a context for evaluating the GEL nodes at a step of a range, as if
+// the step were the current time. tr is the lookback window that ends at the step.
+func withStep(ctx context.Context, tr backend.TimeRange) context.Context {
+	return context.WithValue(ctx, stepKey{}, tr)
+}
+
+// stepRange returns the lookback window of the step of a range evaluation that ctx
+// is for. The step is the end of the window. ok is false if ctx is not for a range
+// evaluation.
+func stepRange(ctx context.Context) (tr backend.TimeRange, ok bool) {
+	tr, ok = ctx.Value(stepKey{}).(backend.TimeRange)
+	return tr, ok
+}
+
+// lookback returns res with each Series limited to the points after from and at
+// or before to. Other values are unchanged.
+func lookback(res mathexp.Results, from, to time.Time) mathexp.Results {
+	newRes := mathexp.Results{Values: make(mathexp.Values, len(res.Values))}
+	for i, val := range res.Values {
+		if s, ok := val.(mathexp.Series); ok {
+			val = s.Between(from, to)
+		}
+		newRes.Values[i] = val
+	}
+	return newRes
+}
+
+// stitcher collects the values of a node at each step into a Series per label set.
+type stitcher struct {
+	series map[string]mathexp.Series
+	keys   []string
+}
+
+func newStitcher() *stitcher {
+	return &stitcher{series: make(map[string]mathexp.Series)}
+}
+
+// add adds a point at the step for each value of res.
+func (st *stitcher) add(step time.Time, res mathexp.Results) {
+	for _, val := range res.Values {
+		f, ok := instantValue(val)
+		if !ok {
+			continue
+		}
+		labels := val.GetLabels()
+		key := labels.String()
+		s, ok := st.series[key]
+		if !ok {
+			s = mathexp.NewSeries(val.GetName(), copyLabels(labels), 0, false, 1, true, 0)
+			st.series[key] = s
+			st.keys = append(st.keys, key)
+		}
+		t := step
+		s.AppendPoint(s.Len(), &t, f)
+	}
+}
+
+// results returns the stitched Series, sorted by their labels.
+func (st *stitcher) results() mathexp.Results {
+	sort.Strings(st.keys)
+	res := mathexp.Results{Values: make(mathexp.Values, 0, len(st.keys))}
+	for _, key := range st.keys {
+		res.Values = append(res.Values, st.series[key])
+	}
+	return res
+}
+
+// instantValue returns the value of val at a step: the value of a Number or Scalar,
+// or the value of the last point of a Series. ok is false if val has no value.
+func instantValue(val mathexp.Value) (f *float64, ok bool) {
+	switch v := val.(type) {
+	case mathexp.Number:
+		return v.GetFloat64Value(), true
+	case mathexp.Scalar:
+		return v.GetFloat64Value(), true
+	case mathexp.Series:
+		var last *time.Time
+		for i := 0; i < v.Len(); i++ {
+			t, pf := v.GetPoint(i)
+			if t != nil && (last == nil || !t.Before(*last)) {
+				last, f, ok = t, pf, true
+			}
+		}
+		return f, ok
+	default:
+		return nil, false
+	}
+}
+
+// copyLabels returns a copy of labels, keeping nil labels nil.
+func copyLabels(labels data.Labels) data.Labels {
+	if labels == nil {
+		return nil
+	}
+	return labels.Copy()
+}
@@ -0,0 +1,255 @@
+package gelpoc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceRange(t *testing.T) {
+	dsDF := data.NewFrame("test",
+		data.NewField("time", nil, []*time.Time{utp(1), utp(2), utp(3), utp(4), utp(5)}),
+		data.NewField("value", nil, []*float64{fp(1), fp(2), fp(3), fp(4), fp(5)}))
+
+	m := newMockTransformCallBack("A", dsDF)
+
+	s := Service{m}
+
+	queries := []backend.DataQuery{
+		{
+			RefID: "A",
+			JSON:  json.RawMessage(`{ "datasource": "test", "datasourceId": 3, "orgId": 1, "intervalMs": 1000, "maxDataPoints": 1000 }`),
+		},
+		{
+			RefID: "B",
+			JSON:  json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "reduce", "reducer": "mean", "expression": "$A" }`),
+		},
+		{
+			RefID: "C",
+			JSON:  json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "math", "expression": "$B > 3" }`),
+		},
+		{
+			RefID: "D",
+			JSON:  json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "math", "expression": "$A * 10" }`),
+		},
+	}
+
+	pl, err := s.BuildPipeline(queries)
+	require.NoError(t, err)
+
+	res, err := s.ExecutePipelineRange(context.Background(), pl, RangeOptions{
+		From:     time.Unix(3, 0),
+		To:       time.Unix(5, 0),
+		Step:     time.Second,
+		Lookback: 2 * time.Second,
+	})
+	require.NoError(t, err)
+
+	// The datasource is queried once for all the steps, over the range and the
+	// lookback before it.
+	require.Len(t, m.Requests, 1)
+	require.Equal(t, backend.TimeRange{From: time.Unix(1, 0), To: time.Unix(5, 0)}, m.Requests[0].Queries[0].TimeRange)
+
+	stitched := func(refID string, fs ...float64) []*data.Frame {
+		times := make([]time.Time, len(fs))
+		vals := make([]*float64, len(fs))
+		for i, f := range fs {
+			times[i] = time.Unix(int64(3+i), 0)
+			vals[i] = fp(f)
+		}
+		df := data.NewFrame("",
+			data.NewField("Time", nil, times),
+			data.NewField("", nil, vals))
+		df.RefID = refID
+		return []*data.Frame{df}
+	}
+	tests := []struct {
+		refID  string
+		frames []*data.Frame
+	}{
+		{"B", stitched("B", 2.5, 3.5, 4.5)},
+		{"C", stitched("C", 0, 1, 1)},
+		{"D", stitched("D", 30, 40, 50)},
+	}
+	for _, tt := range tests {
+		if diff := cmp.Diff(tt.frames, []*data.Frame(res.Responses[tt.refID].Frames), data.FrameTestCompareOptions()...); diff != "" {
+			t.Errorf("Result mismatch for %v (-want +got):\n%s", tt.refID, diff)
+		}
+	}
+	require.Len(t, res.Responses["A"].Frames, 1)
+	require.Equal(t, 5, res.Responses["A"].Frames[0].Rows())
+}
+
+func TestServiceRangeTime(t *testing.T) {
+	dsDF := data.NewFrame("test",
+		data.NewField("time", nil, []*time.Time{utp(1), utp(2), utp(3), utp(4), utp(5)}),
+		data.NewField("value", nil, []*float64{fp(1), fp(2), fp(3), fp(4), fp(5)}))
+
+	s := Service{newMockTransformCallBack("A", dsDF)}
+
+	queries := []backend.DataQuery{
+		{
+			RefID: "A",
+			JSON:  json.RawMessage(`{ "datasource": "test", "datasourceId": 3, "orgId": 1, "intervalMs": 1000, "maxDataPoints": 1000 }`),
+		},
+		{
+			RefID: "B",
+			JSON:  json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "math", "expression": "time()" }`),
+		},
+		{
+			RefID: "C",
+			JSON:  json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "math", "expression": "time() - timestamp($A)" }`),
+		},
+	}
+
+	pl, err := s.BuildPipeline(queries)
+	require.NoError(t, err)
+
+	res, err := s.ExecutePipelineRange(context.Background(), pl, RangeOptions{
+		From:     time.Unix(4, 0),
+		To:       time.Unix(6, 0),
+		Step:     time.Second,
+		Lookback: 2 * time.Second,
+	})
+	require.NoError(t, err)
+
+	values := func(refID string) []float64 {
+		frames := res.Responses[refID].Frames
+		require.Len(t, frames, 1)
+		fs := make([]float64, frames[0].Rows())
+		for i := range fs {
+			fs[i], err = frames[0].FloatAt(1, i)
+			require.NoError(t, err)
+		}
+		return fs
+	}
+	// time() is the time of each step, so the age of the last point grows
+	// once the datasource has no newer points.
+	require.Equal(t, []float64{4, 5, 6}, values("B"))
+	require.Equal(t, []float64{0, 0, 1}, values("C"))
+}
+
+func TestServiceRangeResample(t *testing.T) {
+	dsDF := data.NewFrame("test",
+		data.NewField("time", nil, []*time.Time{utp(1), utp(2), utp(3), utp(4), utp(5)}),
+		data.NewField("value", nil, []*float64{fp(1), fp(2), fp(3), fp(4), fp(5)}))
+
+	s := Service{newMockTransformCallBack("A", dsDF)}
+
+	tr := backend.TimeRange{From: time.Unix(0, 0), To: time.Unix(10, 0)}
+	queries := []backend.DataQuery{
+		{
+			RefID:     "A",
+			TimeRange: tr,
+			JSON:      json.RawMessage(`{ "datasource": "test", "datasourceId": 3, "orgId": 1, "intervalMs": 1000, "maxDataPoints": 1000 }`),
+		},
+		{
+			RefID:     "B",
+			TimeRange: tr,
+			JSON:      json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "resample", "expression": "$A", "rule": "1S", "downsampler": "sum", "upsampler": "fillna" }`),
+		},
+		{
+			RefID: "C",
+			JSON:  json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "reduce", "reducer": "count", "expression": "$B" }`),
+		},
+	}
+
+	pl, err := s.BuildPipeline(queries)
+	require.NoError(t, err)
+
+	res, err := s.ExecutePipelineRange(context.Background(), pl, RangeOptions{
+		From:     time.Unix(3, 0),
+		To:       time.Unix(5, 0),
+		Step:     time.Second,
+		Lookback: 2 * time.Second,
+	})
+	require.NoError(t, err)
+
+	values := func(refID string) []float64 {
+		frames := res.Responses[refID].Frames
+		require.Len(t, frames, 1)
+		fs := make([]float64, frames[0].Rows())
+		for i := range fs {
+			fs[i], err = frames[0].FloatAt(1, i)
+			require.NoError(t, err)
+		}
+		return fs
+	}
+	// Each step is resampled over its lookback window, so the last point is the
+	// value at the step and there are 3 points rather than one per second of the query.
+	require.Equal(t, []float64{3, 4, 5}, values("B"))
+	require.Equal(t, []float64{3, 3, 3}, values("C"))
+}
+
+func TestServiceRangeInvalidOptions(t *testing.T) {
+	s := Service{newMockTransformCallBack("A")}
+	for _, opts := range []RangeOptions{
+		{From: time.Unix(0, 0), To: time.Unix(10, 0), Lookback: time.Second},
+		{From: time.Unix(0, 0), To: time.Unix(10, 0), Step: time.Second},
+		{From: time.Unix(10, 0), To: time.Unix(0, 0), Step: time.Second, Lookback: time.Second},
+		{From: time.Unix(0, 0), To: time.Unix(MaxRangeSteps, 0), Step: time.Second, Lookback: time.Second},
+	} {
+		_, err := s.ExecutePipelineRange(context.Background(), DataPipeline{}, opts)
+		require.Error(t, err)
+	}
+}
+
+func TestRangeOptionsFromQueries(t *testing.T) {
+	tr := backend.TimeRange{From: time.Unix(3, 0), To: time.Unix(5, 0)}
+	dsQuery := backend.DataQuery{
+		RefID:     "A",
+		TimeRange: tr,
+		JSON:      json.RawMessage(`{ "datasource": "test", "datasourceId": 3, "orgId": 1, "intervalMs": 1000, "maxDataPoints": 1000 }`),
+	}
+	rangeQuery := func(refID, rng string) backend.DataQuery {
+		return backend.DataQuery{
+			RefID:     refID,
+			TimeRange: tr,
+			JSON:      json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "math", "expression": "$A * 10", "range": ` + rng + ` }`),
+		}
+	}
+
+	opts, err := RangeOptionsFromQueries([]backend.DataQuery{dsQuery})
+	require.NoError(t, err)
+	require.Nil(t, opts)
+
+	for _, queries := range [][]backend.DataQuery{
+		{dsQuery, rangeQuery("B", `{ "step": "1x" }`)},
+		{dsQuery, rangeQuery("B", `{ "step": "1s", "lookback": "0s" }`)},
+		{dsQuery, rangeQuery("B", `{ "step": "1s", "lookback": "2s" }`), rangeQuery("C", `{ "step": "2s", "lookback": "2s" }`)},
+	} {
+		_, err := RangeOptionsFromQueries(queries)
+		require.Error(t, err)
+	}
+
+	// The request is evaluated at each step of the range, as TransformData does.
+	dsDF := data.NewFrame("test",
+		data.NewField("time", nil, []*time.Time{utp(1), utp(2), utp(3), utp(4), utp(5)}),
+		data.NewField("value", nil, []*float64{fp(1), fp(2), fp(3), fp(4), fp(5)}))
+	s := Service{newMockTransformCallBack("A", dsDF)}
+	queries := []backend.DataQuery{dsQuery, rangeQuery("B", `{ "step": "1s", "lookback": "2s" }`)}
+
+	opts, err = RangeOptionsFromQueries(queries)
+	require.NoError(t, err)
+	require.Equal(t, &RangeOptions{From: tr.From, To: tr.To, Step: time.Second, Lookback: 2 * time.Second}, opts)
+
+	pl, err := s.BuildPipeline(queries)
+	require.NoError(t, err)
+	res, err := s.ExecutePipelineRange(context.Background(), pl, *opts)
+	require.NoError(t, err)
+
+	frames := res.Responses["B"].Frames
+	require.Len(t, frames, 1)
+	require.Equal(t, 3, frames[0].Rows())
+	for i, want := range []float64{30, 40, 50} {
+		f, err := frames[0].FloatAt(1, i)
+		require.NoError(t, err)
+		require.Equal(t, want, f)
+	}
+}
@@ -21,18 +21,105 @@ func (s *Service) BuildPipeline(queries []backend.DataQuery) (DataPipeline, erro
 // ExecutePipeline executes a GEL data pipeline and returns all the results.
 func (s *Service) ExecutePipeline(ctx context.Context, pipeline DataPipeline) (*backend.QueryDataResponse, error) {
 	res := backend.NewQueryDataResponse()
-	vars, err := pipeline.execute(ctx)
+	vars, notices, err := pipeline.execute(ctx)
 	if err != nil {
 		return nil, err
 	}
 	for refID, val := range vars {
-		res.Responses[refID] = backend.DataResponse{
-			Frames: val.Values.AsDataFrames(refID),
-		}
+		res.Responses[refID] = dataResponse(refID, val, notices[refID])
 	}
 	return res, nil
 }
 
+// ExecutePipelineRange executes a GEL data pipeline at every step of a time range,
+// such as to see how an alert condition would have behaved in the past. The datasource
+// queries are run once over the range and the lookback before it, instead of their own
+// time ranges. The results of each GEL node are a Series per label set with a point for
+// each step.
+func (s *Service) ExecutePipelineRange(ctx context.Context, pipeline DataPipeline, opts RangeOptions) (*backend.QueryDataResponse, error) {
+	res := backend.NewQueryDataResponse()
+	vars, notices, err := pipeline.executeRange(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for refID, val := range vars {
+		res.Responses[refID] = dataResponse(refID, val, notices[refID])
+	}
+	return res, nil
+}
+
+// noDataKey is the key in the custom metadata of the frames of a NoData response
+// that marks the response as NoData, see IsNoData.
+const noDataKey = "noData"
+
+// dataResponse returns the response for the results of a refId, with the notices
+// of the results. If the results have no data (see mathexp.Results.NoData), the
+// frames are marked as NoData.
+func dataResponse(refID string, res mathexp.Results, notices []data.Notice) backend.DataResponse {
+	frames := res.Values.AsDataFrames(refID)
+	if len(notices) != 0 {
+		frames = withMeta(refID, frames, func(meta *data.FrameMeta) {
+			meta.Notices = append(meta.Notices, notices...)
+		})
+	}
+	if res.NoData() {
+		frames = withMeta(refID, frames, func(meta *data.FrameMeta) {
+			custom := map[string]interface{}{}
+			if existing, ok := meta.Custom.(map[string]interface{}); ok {
+				for k, v := range existing {
+					custom[k] = v
+				}
+			}
+			custom[noDataKey] = true
+			meta.Custom = custom
+		})
+	}
+	return backend.DataResponse{Frames: frames}
+}
+
+// withMeta returns frames with set applied to the metadata of each frame. The frames
+// and their metadata are copied first, as they may be shared with the results of
+// other nodes. If there are no frames, set is applied to an empty frame, so that the
+// metadata is returned even if there are no results.
+func withMeta(refID string, frames []*data.Frame, set func(meta *data.FrameMeta)) []*data.Frame {
+	if len(frames) == 0 {
+		frame := data.NewFrame("")
+		frame.RefID = refID
+		frames = []*data.Frame{frame}
+	}
+	newFrames := make([]*data.Frame, len(frames))
+	for i, frame := range frames {
+		newFrame := *frame
+		meta := &data.FrameMeta{}
+		if frame.Meta != nil {
+			*meta = *frame.Meta
+			meta.Notices = append([]data.Notice(nil), frame.Meta.Notices...)
+		}
+		set(meta)
+		newFrame.Meta = meta
+		newFrames[i] = &newFrame
+	}
+	return newFrames
+}
+
+// IsNoData returns true if the response for a refId is NoData, which is when the
+// datasource or expression returned no series, or only null or NaN values (see
+// mathexp.Results.NoData). A response with an error is not NoData.
+func IsNoData(dr backend.DataResponse) bool {
+	if dr.Error != nil {
+		return false
+	}
+	for _, frame := range dr.Frames {
+		if frame.Meta == nil {
+			continue
+		}
+		if custom, ok := frame.Meta.Custom.(map[string]interface{}); ok && custom[noDataKey] == true {
+			return true
+		}
+	}
+	return false
+}
+
 func extractDataFrames(vars mathexp.Vars) []*data.Frame {
 	res := []*data.Frame{}
 	for refID, results := range vars {
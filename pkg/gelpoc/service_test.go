@@ -3,6 +3,8 @@ package gelpoc
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"math"
 	"sort"
 	"testing"
 	"time"
@@ -71,8 +73,335 @@ func TestService(t *testing.T) {
 	}
 }
 
+func TestUnmarshalReduceCommand(t *testing.T) {
+	var tests = []struct {
+		name     string
+		query    map[string]interface{}
+		errIs    require.ErrorAssertionFunc
+		nullMode mathexp.NullMode
+		mapper   mathexp.ReduceMapper
+	}{
+		{
+			name:  "strict by default",
+			query: map[string]interface{}{"expression": "$A", "reducer": "mean"},
+			errIs: require.NoError,
+		},
+		{
+			name:   "mode",
+			query:  map[string]interface{}{"expression": "$A", "reducer": "mean", "mode": "replaceNN", "replaceWithValue": 1.0},
+			errIs:  require.NoError,
+			mapper: mathexp.ReplaceNonNumberWithValue{Value: 1},
+		},
+		{
+			name:     "null mode",
+			query:    map[string]interface{}{"expression": "$A", "reducer": "mean", "nullMode": "zero"},
+			errIs:    require.NoError,
+			nullMode: mathexp.NullModeZero,
+		},
+		{
+			name:  "mode with a null mode",
+			query: map[string]interface{}{"expression": "$A", "reducer": "mean", "mode": "dropNN", "nullMode": "zero"},
+			errIs: require.Error,
+		},
+		{
+			name:  "strict mode with a null mode",
+			query: map[string]interface{}{"expression": "$A", "reducer": "mean", "mode": "strict", "nullMode": "skip"},
+			errIs: require.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := UnmarshalReduceCommand(&rawNode{RefID: "B", Query: tt.query})
+			tt.errIs(t, err)
+			if err != nil {
+				return
+			}
+			require.Equal(t, tt.nullMode, rc.NullMode)
+			require.Equal(t, tt.mapper, rc.Mapper)
+		})
+	}
+}
+
+func TestServiceTimeShift(t *testing.T) {
+	dsDF := data.NewFrame("test",
+		data.NewField("time", nil, []*time.Time{utp(1)}),
+		data.NewField("value", nil, []*float64{fp(2)}))
+
+	m := newMockTransformCallBack("A", dsDF)
+
+	s := Service{m}
+
+	tr := backend.TimeRange{From: time.Unix(604800, 0), To: time.Unix(2*604800, 0)}
+	queries := []backend.DataQuery{
+		{
+			RefID:     "A",
+			TimeRange: tr,
+			JSON:      json.RawMessage(`{ "datasource": "test", "datasourceId": 3, "orgId": 1, "intervalMs": 1000, "maxDataPoints": 1000, "timeShift": "1w" }`),
+		},
+	}
+
+	pl, err := s.BuildPipeline(queries)
+	require.NoError(t, err)
+
+	res, err := s.ExecutePipeline(context.Background(), pl)
+	require.NoError(t, err)
+
+	require.Len(t, m.Requests, 1)
+	require.Len(t, m.Requests[0].Queries, 1)
+	require.Equal(t, backend.TimeRange{From: time.Unix(0, 0), To: time.Unix(604800, 0)}, m.Requests[0].Queries[0].TimeRange)
+
+	aDF := data.NewFrame("test",
+		data.NewField("time", nil, []*time.Time{utp(604801)}),
+		data.NewField("value", nil, []*float64{fp(2)}))
+	aDF.RefID = "A"
+	if diff := cmp.Diff(data.Frames{aDF}, res.Responses["A"].Frames, data.FrameTestCompareOptions()...); diff != "" {
+		t.Errorf("Result mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestServiceInvalidTimeShift(t *testing.T) {
+	s := Service{newMockTransformCallBack("A")}
+	queries := []backend.DataQuery{
+		{
+			RefID: "A",
+			JSON:  json.RawMessage(`{ "datasource": "test", "datasourceId": 3, "orgId": 1, "intervalMs": 1000, "maxDataPoints": 1000, "timeShift": "a week" }`),
+		},
+	}
+	_, err := s.BuildPipeline(queries)
+	require.Error(t, err)
+}
+
+func TestServiceDroppedUnionsNotice(t *testing.T) {
+	series := func(host string) *data.Frame {
+		return data.NewFrame("",
+			data.NewField("time", nil, []*time.Time{utp(1)}),
+			data.NewField("value", data.Labels{"host": host}, []*float64{fp(1)}))
+	}
+	m := refIDTransformCallBack{
+		"A": {series("a"), series("b")},
+		"B": {series("c"), series("d")},
+	}
+
+	s := Service{m}
+
+	queries := []backend.DataQuery{
+		{
+			RefID: "A",
+			JSON:  json.RawMessage(`{ "datasource": "test", "datasourceId": 3, "orgId": 1, "intervalMs": 1000, "maxDataPoints": 1000 }`),
+		},
+		{
+			RefID: "B",
+			JSON:  json.RawMessage(`{ "datasource": "test", "datasourceId": 3, "orgId": 1, "intervalMs": 1000, "maxDataPoints": 1000 }`),
+		},
+		{
+			RefID: "C",
+			JSON:  json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "math", "expression": "$A + $B" }`),
+		},
+	}
+
+	pl, err := s.BuildPipeline(queries)
+	require.NoError(t, err)
+
+	res, err := s.ExecutePipeline(context.Background(), pl)
+	require.NoError(t, err)
+
+	// Every combination is dropped, so the notice is on an empty frame.
+	require.Len(t, res.Responses["C"].Frames, 1)
+	frame := res.Responses["C"].Frames[0]
+	require.Equal(t, "C", frame.RefID)
+	require.Empty(t, frame.Fields)
+	require.NotNil(t, frame.Meta)
+	require.Len(t, frame.Meta.Notices, 1)
+	require.Equal(t, data.NoticeSeverityWarning, frame.Meta.Notices[0].Severity)
+	require.Contains(t, frame.Meta.Notices[0].Text, "4 combination(s) of results in $A + $B were dropped")
+
+	for _, refID := range []string{"A", "B"} {
+		require.Len(t, res.Responses[refID].Frames, 2)
+		for _, frame := range res.Responses[refID].Frames {
+			require.Nil(t, frame.Meta, "input frames are not modified")
+		}
+	}
+}
+
+func TestServiceResampleAutoRule(t *testing.T) {
+	dsDF := data.NewFrame("test",
+		data.NewField("time", nil, []*time.Time{utp(1), utp(15), utp(25)}),
+		data.NewField("value", nil, []*float64{fp(1), fp(2), fp(3)}))
+
+	s := Service{newMockTransformCallBack("A", dsDF)}
+
+	tr := backend.TimeRange{From: time.Unix(0, 0), To: time.Unix(3600, 0)}
+	queries := []backend.DataQuery{
+		{
+			RefID:     "A",
+			TimeRange: tr,
+			JSON:      json.RawMessage(`{ "datasource": "test", "datasourceId": 3, "orgId": 1, "intervalMs": 1000, "maxDataPoints": 1000 }`),
+		},
+		{
+			RefID:     "B",
+			TimeRange: tr,
+			JSON:      json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "resample", "expression": "$A", "rule": "auto", "downsampler": "sum", "upsampler": "fillna", "intervalMs": 1000, "maxDataPoints": 360 }`),
+		},
+	}
+
+	pl, err := s.BuildPipeline(queries)
+	require.NoError(t, err)
+
+	var rc *ResampleCommand
+	for _, node := range pl {
+		if gn, ok := node.(*GELNode); ok {
+			rc, _ = gn.GELCommand.(*ResampleCommand)
+		}
+	}
+	require.NotNil(t, rc)
+	// An hour in at most 360 points of at least a second is a point every 10 seconds.
+	require.Equal(t, "10S", rc.Rule)
+
+	res, err := s.ExecutePipeline(context.Background(), pl)
+	require.NoError(t, err)
+
+	frames := res.Responses["B"].Frames
+	require.Len(t, frames, 1)
+	require.Equal(t, 361, frames[0].Rows())
+	for i, want := range []*float64{nil, fp(1), fp(2), fp(3)} {
+		require.Equal(t, want, frames[0].At(1, i), "point %v", i)
+	}
+}
+
+func TestServiceNoData(t *testing.T) {
+	m := newMockTransformCallBack("A")
+
+	s := Service{m}
+
+	queries := []backend.DataQuery{
+		{
+			RefID: "A",
+			JSON:  json.RawMessage(`{ "datasource": "test", "datasourceId": 3, "orgId": 1, "intervalMs": 1000, "maxDataPoints": 1000 }`),
+		},
+		{
+			RefID: "B",
+			JSON:  json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "math", "expression": "absent($A)" }`),
+		},
+		{
+			RefID: "C",
+			JSON:  json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "math", "expression": "$A * 2" }`),
+		},
+	}
+
+	pl, err := s.BuildPipeline(queries)
+	require.NoError(t, err)
+
+	res, err := s.ExecutePipeline(context.Background(), pl)
+	require.NoError(t, err)
+
+	// Responses without results get an empty frame for the NoData marker.
+	for _, refID := range []string{"A", "C"} {
+		require.True(t, IsNoData(res.Responses[refID]), refID)
+		require.Len(t, res.Responses[refID].Frames, 1, refID)
+		require.Equal(t, refID, res.Responses[refID].Frames[0].RefID)
+		require.Empty(t, res.Responses[refID].Frames[0].Fields, refID)
+	}
+	require.False(t, IsNoData(res.Responses["B"]))
+
+	absent, err := res.Responses["B"].Frames[0].FloatAt(0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1.0, absent)
+
+	// Series of only null values are NoData, and keep their frames.
+	nullSeries := data.NewFrame("",
+		data.NewField("time", nil, []*time.Time{utp(1), utp(2)}),
+		data.NewField("value", nil, []*float64{nil, fp(math.NaN())}))
+	s = Service{newMockTransformCallBack("A", nullSeries)}
+	pl, err = s.BuildPipeline(queries)
+	require.NoError(t, err)
+	res, err = s.ExecutePipeline(context.Background(), pl)
+	require.NoError(t, err)
+
+	require.True(t, IsNoData(res.Responses["A"]))
+	require.Len(t, res.Responses["A"].Frames, 1)
+	require.Equal(t, 2, res.Responses["A"].Frames[0].Rows())
+	require.True(t, IsNoData(res.Responses["C"]))
+	require.False(t, IsNoData(res.Responses["B"]))
+}
+
+func TestIsNoData(t *testing.T) {
+	nullSeries := data.NewFrame("",
+		data.NewField("time", nil, []*time.Time{utp(1), utp(2)}),
+		data.NewField("value", nil, []*float64{nil, fp(math.NaN())}))
+	// Only the NoData marker of dataResponse makes a response NoData.
+	require.False(t, IsNoData(backend.DataResponse{Frames: data.Frames{nullSeries}}))
+
+	names := data.NewFrame("", data.NewField("name", nil, []string{"a"}))
+	notice := data.NewFrame("")
+	notice.AppendNotices(data.Notice{Text: "No data"})
+	require.False(t, IsNoData(backend.DataResponse{Frames: data.Frames{names, notice}}))
+
+	require.True(t, IsNoData(dataResponse("A", mathexp.Results{}, nil)))
+	require.False(t, IsNoData(backend.DataResponse{Error: fmt.Errorf("query failed")}))
+}
+
+func TestServiceTopK(t *testing.T) {
+	series := func(host string, f float64) *data.Frame {
+		return data.NewFrame("",
+			data.NewField("time", nil, []*time.Time{utp(1)}),
+			data.NewField("value", data.Labels{"host": host}, []*float64{fp(f)}))
+	}
+	m := newMockTransformCallBack("A", series("a", 1), series("b", 5), series("c", 3))
+
+	s := Service{m}
+
+	queries := []backend.DataQuery{
+		{
+			RefID: "A",
+			JSON:  json.RawMessage(`{ "datasource": "test", "datasourceId": 3, "orgId": 1, "intervalMs": 1000, "maxDataPoints": 1000 }`),
+		},
+		{
+			RefID: "B",
+			JSON:  json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "topk", "expression": "$A", "k": 2, "reducer": "mean", "other": "sum" }`),
+		},
+	}
+
+	pl, err := s.BuildPipeline(queries)
+	require.NoError(t, err)
+
+	res, err := s.ExecutePipeline(context.Background(), pl)
+	require.NoError(t, err)
+
+	frames := res.Responses["B"].Frames
+	require.Len(t, frames, 3)
+	var hosts []string
+	var values []float64
+	for _, frame := range frames {
+		hosts = append(hosts, frame.Fields[1].Labels.String())
+		f, err := frame.FloatAt(1, 0)
+		require.NoError(t, err)
+		values = append(values, f)
+	}
+	require.Equal(t, []string{"host=b", "host=c", mathexp.OtherLabel + "=true"}, hosts)
+	require.Equal(t, []float64{5, 3, 1}, values)
+}
+
+func TestServiceInvalidTopK(t *testing.T) {
+	s := Service{newMockTransformCallBack("A")}
+	queries := []backend.DataQuery{
+		{
+			RefID: "B",
+			JSON:  json.RawMessage(`{ "datasource": "__expr__", "datasourceId": -100, "type": "topk", "expression": "$A", "k": -1, "reducer": "mean" }`),
+		},
+	}
+	_, err := s.BuildPipeline(queries)
+	require.Error(t, err)
+
+	// A huge k selects all the values instead of overflowing.
+	tc, err := UnmarshalTopKCommand(&rawNode{RefID: "B", Query: map[string]interface{}{"expression": "$A", "k": 1e300, "reducer": "mean"}})
+	require.NoError(t, err)
+	require.True(t, tc.K > 0)
+}
+
 type mockTransformCallBack struct {
 	DataQueryFn func() (*backend.QueryDataResponse, error)
+	// Requests are the requests passed to QueryData.
+	Requests []*backend.QueryDataRequest
 }
 
 func newMockTransformCallBack(refID string, df ...*data.Frame) *mockTransformCallBack {
@@ -104,9 +433,22 @@ func newMockTransformCallBack(refID string, df ...*data.Frame) *mockTransformCal
 }
 
 func (m *mockTransformCallBack) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+	m.Requests = append(m.Requests, req)
 	return m.DataQueryFn()
 }
 
+// refIDTransformCallBack is a mock callback that returns the frames of the refId of
+// each query.
+type refIDTransformCallBack map[string][]*data.Frame
+
+func (m refIDTransformCallBack) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+	res := backend.NewQueryDataResponse()
+	for _, q := range req.Queries {
+		res.Responses[q.RefID] = backend.DataResponse{Frames: m[q.RefID]}
+	}
+	return res, nil
+}
+
 func utp(sec int64) *time.Time {
 	t := time.Unix(sec, 0)
 	return &t
@@ -0,0 +1,312 @@
+package mathexp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Aggregator is a function that aggregates values across results,
+// such as a sum or a quantile.
+type Aggregator struct {
+	Name string
+	// Param is the parameter for aggregators that take one (e.g. the quantile).
+	Param float64
+}
+
+// ParseAggregator parses an aggregator string. Valid aggregators are sum,
+// mean (or avg), min, max, count, stddev, and quantile(q) where 0 <= q <= 1.
+func ParseAggregator(s string) (Aggregator, error) {
+	s = strings.TrimSpace(s)
+	name, param, hasParam, err := parseCall(s)
+	if err != nil {
+		return Aggregator{}, fmt.Errorf("invalid aggregator %q: %w", s, err)
+	}
+	switch name {
+	case "avg":
+		name = "mean"
+		fallthrough
+	case "sum", "mean", "min", "max", "count", "stddev":
+		if hasParam {
+			return Aggregator{}, fmt.Errorf("aggregator %v does not take a parameter", name)
+		}
+		return Aggregator{Name: name}, nil
+	case "quantile":
+		if !hasParam {
+			return Aggregator{}, fmt.Errorf("aggregator quantile requires a parameter, e.g. quantile(0.95)")
+		}
+		q, err := strconv.ParseFloat(param, 64)
+		if err != nil || q < 0 || q > 1 {
+			return Aggregator{}, fmt.Errorf("quantile must be a number between 0 and 1, got %q", param)
+		}
+		return Aggregator{Name: name, Param: q}, nil
+	default:
+		return Aggregator{}, fmt.Errorf("aggregator %v not implemented", name)
+	}
+}
+
+// String returns the string representation of the Aggregator.
+func (a Aggregator) String() string {
+	if a.Name == "quantile" {
+		return fmt.Sprintf("quantile(%v)", a.Param)
+	}
+	return a.Name
+}
+
+// aggregate applies the Aggregator to vals. vals must not be empty.
+func (a Aggregator) aggregate(vals []float64) float64 {
+	switch a.Name {
+	case "sum":
+		return sumFloats(vals)
+	case "mean":
+		return sumFloats(vals) / float64(len(vals))
+	case "min":
+		f := vals[0]
+		for _, v := range vals[1:] {
+			if v < f || math.IsNaN(v) {
+				f = v
+			}
+		}
+		return f
+	case "max":
+		f := vals[0]
+		for _, v := range vals[1:] {
+			if v > f || math.IsNaN(v) {
+				f = v
+			}
+		}
+		return f
+	case "count":
+		return float64(len(vals))
+	case "stddev":
+		return stdDevFloats(vals)
+	case "quantile":
+		return quantileFloats(vals, a.Param)
+	}
+	return math.NaN()
+}
+
+func sumFloats(vals []float64) float64 {
+	var sum float64
+	for _, v := range vals {
+		sum += v
+	}
+	return sum
+}
+
+// stdDevFloats returns the population standard deviation of vals.
+func stdDevFloats(vals []float64) float64 {
+	return math.Sqrt(varianceFloats(vals))
+}
+
+// varianceFloats returns the population variance of vals.
+func varianceFloats(vals []float64) float64 {
+	mean := sumFloats(vals) / float64(len(vals))
+	var sq float64
+	for _, v := range vals {
+		sq += (v - mean) * (v - mean)
+	}
+	return sq / float64(len(vals))
+}
+
+// quantileFloats returns the q-quantile of vals, linearly interpolating between
+// the closest ranks. This is the same method as Excel's PERCENTILE.INC
+// and NumPy's default. vals is not modified.
+func quantileFloats(vals []float64, q float64) float64 {
+	sorted := make([]float64, len(vals))
+	copy(sorted, vals)
+	sort.Float64s(sorted)
+	rank := q * float64(len(sorted)-1)
+	lower := math.Floor(rank)
+	upper := math.Ceil(rank)
+	if lower == upper {
+		return sorted[int(lower)]
+	}
+	return sorted[int(lower)] + (rank-lower)*(sorted[int(upper)]-sorted[int(lower)])
+}
+
+// Grouping describes which labels are kept when aggregating across results.
+// When Without is false only the listed Labels are kept ("by"),
+// otherwise all labels except the listed Labels are kept ("without").
+type Grouping struct {
+	Without bool
+	Labels  []string
+}
+
+// ParseGrouping parses a grouping string such as "by(host, env)" or
+// "without(instance)". An empty string groups everything together.
+func ParseGrouping(s string) (Grouping, error) {
+	g := Grouping{}
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return g, nil
+	}
+	name, param, hasParam, err := parseCall(s)
+	if err != nil || !hasParam {
+		return g, fmt.Errorf("invalid grouping %q, expected by(labels...) or without(labels...)", s)
+	}
+	switch name {
+	case "by":
+	case "without":
+		g.Without = true
+	default:
+		return g, fmt.Errorf("invalid grouping %q, expected by(labels...) or without(labels...)", s)
+	}
+	for _, l := range strings.Split(param, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			g.Labels = append(g.Labels, l)
+		}
+	}
+	return g, nil
+}
+
+// String returns the string representation of the Grouping.
+func (g Grouping) String() string {
+	if g.Without {
+		return fmt.Sprintf("without(%v)", strings.Join(g.Labels, ", "))
+	}
+	return fmt.Sprintf("by(%v)", strings.Join(g.Labels, ", "))
+}
+
+// groupLabels returns the labels of the group that l belongs to.
+func (g Grouping) groupLabels(l data.Labels) data.Labels {
+	gl := data.Labels{}
+	if g.Without {
+		for k, v := range l {
+			gl[k] = v
+		}
+		for _, k := range g.Labels {
+			delete(gl, k)
+		}
+		return gl
+	}
+	for _, k := range g.Labels {
+		if v, ok := l[k]; ok {
+			gl[k] = v
+		}
+	}
+	return gl
+}
+
+// parseCall parses strings such as "name" or "name(param)".
+func parseCall(s string) (name, param string, hasParam bool, err error) {
+	open := strings.Index(s, "(")
+	if open == -1 {
+		return s, "", false, nil
+	}
+	if !strings.HasSuffix(s, ")") {
+		return "", "", false, fmt.Errorf("missing closing parenthesis")
+	}
+	return strings.TrimSpace(s[:open]), strings.TrimSpace(s[open+1 : len(s)-1]), true, nil
+}
+
+// Aggregate aggregates the values in the Results across each other into groups
+// defined by the Grouping. The values must be all Numbers or all Series.
+//
+// Numbers result in one Number per group. Series are aligned by time, and result in
+// one Series per group with a point for every time that exists in any of the group's
+// series. Null values are ignored. If all values at a time are null the point is null.
+func (r Results) Aggregate(agg Aggregator, g Grouping) (Results, error) {
+	return r.AggregateWithNullMode(agg, g, NullModeDefault)
+}
+
+// AggregateWithNullMode is like Aggregate, but null values are handled according
+// to the NullMode. NullModeDefault is the same as NullModeSkip.
+func (r Results) AggregateWithNullMode(agg Aggregator, g Grouping, nullMode NullMode) (Results, error) {
+	newRes := Results{Values: Values{}}
+	if len(r.Values) == 0 {
+		return newRes, nil
+	}
+
+	var groupOrder []string
+	groups := make(map[string][]Value)
+	groupLabels := make(map[string]data.Labels)
+	for _, val := range r.Values {
+		if val.Type() != r.Values[0].Type() {
+			return newRes, fmt.Errorf("can not aggregate mixed types %v and %v", r.Values[0].Type(), val.Type())
+		}
+		l := g.groupLabels(val.GetLabels())
+		key := l.String()
+		if _, ok := groups[key]; !ok {
+			groupOrder = append(groupOrder, key)
+			groupLabels[key] = l
+		}
+		groups[key] = append(groups[key], val)
+	}
+
+	for _, key := range groupOrder {
+		var newVal Value
+		var err error
+		switch r.Values[0].(type) {
+		case Number:
+			newVal = aggregateNumbers(agg, groupLabels[key], groups[key], nullMode)
+		case Series:
+			newVal, err = aggregateSeries(agg, groupLabels[key], groups[key], nullMode)
+		default:
+			return newRes, fmt.Errorf("can only aggregate numbers or series, got type %v", r.Values[0].Type())
+		}
+		if err != nil {
+			return newRes, err
+		}
+		newRes.Values = append(newRes.Values, newVal)
+	}
+	return newRes, nil
+}
+
+func aggregateNumbers(agg Aggregator, labels data.Labels, vals []Value, nullMode NullMode) Number {
+	number := NewNumber(agg.Name, labels)
+	floats := make([]*float64, 0, len(vals))
+	for _, val := range vals {
+		floats = append(floats, val.(Number).GetFloat64Value())
+	}
+	number.SetValue(agg.aggregateNullable(floats, nullMode))
+	return number
+}
+
+// aggregateNullable aggregates vals handling nulls according to the NullMode.
+// The result is null if there are no values to aggregate.
+func (a Aggregator) aggregateNullable(vals []*float64, nullMode NullMode) *float64 {
+	floats, r, ok := nullMode.reduceInputs(vals)
+	if !ok {
+		return r
+	}
+	if len(floats) == 0 {
+		return nil
+	}
+	f := a.aggregate(floats)
+	return &f
+}
+
+func aggregateSeries(agg Aggregator, labels data.Labels, vals []Value, nullMode NullMode) (Series, error) {
+	byTime := make(map[time.Time][]*float64)
+	var times []time.Time
+	for _, val := range vals {
+		s := val.(Series)
+		for i := 0; i < s.Len(); i++ {
+			t, f := s.GetPoint(i)
+			if t == nil {
+				continue
+			}
+			floats, ok := byTime[*t]
+			if !ok {
+				times = append(times, *t)
+			}
+			byTime[*t] = append(floats, f)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	newSeries := NewSeries(agg.Name, labels, 0, false, 1, true, len(times))
+	for i, t := range times {
+		t := t
+		if err := newSeries.SetPoint(i, &t, agg.aggregateNullable(byTime[t], nullMode)); err != nil {
+			return newSeries, err
+		}
+	}
+	return newSeries, nil
+}
@@ -0,0 +1,226 @@
+package mathexp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAggregator(t *testing.T) {
+	var tests = []struct {
+		name       string
+		aggregator string
+		errIs      assert.ErrorAssertionFunc
+		result     Aggregator
+	}{
+		{"sum", "sum", assert.NoError, Aggregator{Name: "sum"}},
+		{"avg is an alias of mean", "avg", assert.NoError, Aggregator{Name: "mean"}},
+		{"quantile", "quantile(0.95)", assert.NoError, Aggregator{Name: "quantile", Param: 0.95}},
+		{"quantile without param", "quantile", assert.Error, Aggregator{}},
+		{"quantile out of range", "quantile(2)", assert.Error, Aggregator{}},
+		{"param on sum", "sum(1)", assert.Error, Aggregator{}},
+		{"unknown", "foo", assert.Error, Aggregator{}},
+		{"unclosed", "quantile(0.5", assert.Error, Aggregator{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agg, err := ParseAggregator(tt.aggregator)
+			tt.errIs(t, err)
+			assert.Equal(t, tt.result, agg)
+		})
+	}
+}
+
+func TestParseGrouping(t *testing.T) {
+	var tests = []struct {
+		name     string
+		grouping string
+		errIs    assert.ErrorAssertionFunc
+		result   Grouping
+	}{
+		{"empty", "", assert.NoError, Grouping{}},
+		{"by", "by(host, env)", assert.NoError, Grouping{Labels: []string{"host", "env"}}},
+		{"without", "without( instance )", assert.NoError, Grouping{Without: true, Labels: []string{"instance"}}},
+		{"by nothing", "by()", assert.NoError, Grouping{}},
+		{"no parens", "by", assert.Error, Grouping{}},
+		{"unknown", "foo(host)", assert.Error, Grouping{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := ParseGrouping(tt.grouping)
+			tt.errIs(t, err)
+			assert.Equal(t, tt.result, g)
+		})
+	}
+}
+
+func TestQuantileFloats(t *testing.T) {
+	vals := []float64{4, 1, 3, 2}
+	assert.Equal(t, 1.0, quantileFloats(vals, 0))
+	assert.Equal(t, 2.5, quantileFloats(vals, 0.5))
+	assert.Equal(t, 3.7, math.Round(quantileFloats(vals, 0.9)*10)/10)
+	assert.Equal(t, 4.0, quantileFloats(vals, 1))
+	assert.Equal(t, []float64{4, 1, 3, 2}, vals, "input is not modified")
+}
+
+func TestAggregate(t *testing.T) {
+	numbers := Results{
+		[]Value{
+			makeNumber("", data.Labels{"host": "a", "cpu": "0"}, float64Pointer(1)),
+			makeNumber("", data.Labels{"host": "a", "cpu": "1"}, float64Pointer(3)),
+			makeNumber("", data.Labels{"host": "b", "cpu": "0"}, float64Pointer(5)),
+			makeNumber("", data.Labels{"host": "b", "cpu": "1"}, nil),
+		},
+	}
+	series := Results{
+		[]Value{
+			makeSeries("", data.Labels{"host": "a", "cpu": "0"}, tp{
+				time.Unix(5, 0), float64Pointer(1),
+			}, tp{
+				time.Unix(10, 0), float64Pointer(2),
+			}),
+			makeSeries("", data.Labels{"host": "a", "cpu": "1"}, tp{
+				time.Unix(10, 0), float64Pointer(4),
+			}, tp{
+				time.Unix(15, 0), nil,
+			}),
+		},
+	}
+	var tests = []struct {
+		name       string
+		input      Results
+		aggregator Aggregator
+		grouping   Grouping
+		errIs      assert.ErrorAssertionFunc
+		results    Results
+	}{
+		{
+			name:       "sum numbers by host ignores nulls",
+			input:      numbers,
+			aggregator: Aggregator{Name: "sum"},
+			grouping:   Grouping{Labels: []string{"host"}},
+			errIs:      assert.NoError,
+			results: Results{
+				[]Value{
+					makeNumber("sum", data.Labels{"host": "a"}, float64Pointer(4)),
+					makeNumber("sum", data.Labels{"host": "b"}, float64Pointer(5)),
+				},
+			},
+		},
+		{
+			name:       "max numbers without host",
+			input:      numbers,
+			aggregator: Aggregator{Name: "max"},
+			grouping:   Grouping{Without: true, Labels: []string{"host"}},
+			errIs:      assert.NoError,
+			results: Results{
+				[]Value{
+					makeNumber("max", data.Labels{"cpu": "0"}, float64Pointer(5)),
+					makeNumber("max", data.Labels{"cpu": "1"}, float64Pointer(3)),
+				},
+			},
+		},
+		{
+			name:       "count all numbers",
+			input:      numbers,
+			aggregator: Aggregator{Name: "count"},
+			grouping:   Grouping{},
+			errIs:      assert.NoError,
+			results: Results{
+				[]Value{
+					makeNumber("count", data.Labels{}, float64Pointer(3)),
+				},
+			},
+		},
+		{
+			name:       "stddev all numbers",
+			input:      numbers,
+			aggregator: Aggregator{Name: "stddev"},
+			grouping:   Grouping{},
+			errIs:      assert.NoError,
+			results: Results{
+				[]Value{
+					makeNumber("stddev", data.Labels{}, float64Pointer(math.Sqrt(8.0/3))),
+				},
+			},
+		},
+		{
+			name:       "mean series by host aligns on time",
+			input:      series,
+			aggregator: Aggregator{Name: "mean"},
+			grouping:   Grouping{Labels: []string{"host"}},
+			errIs:      assert.NoError,
+			results: Results{
+				[]Value{
+					makeSeries("mean", data.Labels{"host": "a"}, tp{
+						time.Unix(5, 0), float64Pointer(1),
+					}, tp{
+						time.Unix(10, 0), float64Pointer(3),
+					}, tp{
+						time.Unix(15, 0), nil,
+					}),
+				},
+			},
+		},
+		{
+			name:       "empty results",
+			input:      Results{},
+			aggregator: Aggregator{Name: "sum"},
+			errIs:      assert.NoError,
+			results:    Results{Values{}},
+		},
+		{
+			name: "mixed types",
+			input: Results{
+				[]Value{
+					makeNumber("", nil, float64Pointer(1)),
+					makeSeries("", nil),
+				},
+			},
+			aggregator: Aggregator{Name: "sum"},
+			errIs:      assert.Error,
+			results:    Results{Values{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.input.Aggregate(tt.aggregator, tt.grouping)
+			tt.errIs(t, err)
+			if diff := cmp.Diff(tt.results, res, data.FrameTestCompareOptions()...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAggregateFunc(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "a", "cpu": "0"}, float64Pointer(1)),
+				makeNumber("", data.Labels{"host": "a", "cpu": "1"}, float64Pointer(3)),
+			},
+		},
+	}
+	e, err := New(`aggregate($A, "quantile(0.5)", "by(host)")`)
+	assert.NoError(t, err)
+	res, err := e.Execute(vars)
+	assert.NoError(t, err)
+	expected := Results{
+		[]Value{
+			makeNumber("quantile", data.Labels{"host": "a"}, float64Pointer(2)),
+		},
+	}
+	if diff := cmp.Diff(expected, res, data.FrameTestCompareOptions()...); diff != "" {
+		t.Errorf("Result mismatch (-want +got):\n%s", diff)
+	}
+
+	e, err = New(`aggregate($A, "foo", "")`)
+	assert.NoError(t, err)
+	_, err = e.Execute(vars)
+	assert.Error(t, err)
+}
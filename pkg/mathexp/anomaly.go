@@ -0,0 +1,146 @@
+package mathexp
+
+import (
+	"math"
+	"time"
+)
+
+// madScale scales the median absolute deviation so it estimates the standard
+// deviation of normally distributed values.
+const madScale = 1.4826
+
+// ZScore returns a Series where each point is the number of standard deviations the
+// value of s is from the mean of the values in the window before that point. A window
+// of points has the points before that point, and a duration window has the points
+// within the duration before that point. The point itself is not in the window, so an
+// outlier does not hide itself.
+//
+// Null and NaN values are ignored in the window and give a null point. If the window
+// has fewer than two values the point is null, and if the values of the window are all
+// the same the point is 0 when equal to them and positive or negative infinity otherwise.
+// Points are sorted by time and points with null times are dropped.
+func (s Series) ZScore(w Window) Series {
+	points := sortedPoints(s)
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, true, 0)
+	start := 0
+	for i, p := range points {
+		p := p
+		if w.Points > 0 {
+			if i-start > w.Points {
+				start = i - w.Points
+			}
+		} else {
+			for start < i && p.t.Sub(points[start].t) >= w.Duration {
+				start++
+			}
+		}
+		var vals []float64
+		for _, wp := range points[start:i] {
+			if !missing(wp.f) {
+				vals = append(vals, *wp.f)
+			}
+		}
+		var f *float64
+		if !missing(p.f) && len(vals) >= 2 {
+			mean := sumFloats(vals) / float64(len(vals))
+			z := 0.0
+			if d := *p.f - mean; d != 0 {
+				z = d / stdDevFloats(vals)
+			}
+			f = &z
+		}
+		newSeries.AppendPoint(i, &p.t, f)
+	}
+	return newSeries
+}
+
+// MADOutliers returns a Series where each point is 1 if the value of s is an outlier
+// and 0 otherwise. A value is an outlier if its distance from the median of the values
+// of s is more than threshold times the median absolute deviation, scaled to estimate
+// the standard deviation. If the median absolute deviation is 0, every value that is
+// not the median is an outlier.
+//
+// Null and NaN values are ignored and give a null point. Points are sorted by time and
+// points with null times are dropped.
+func (s Series) MADOutliers(threshold float64) Series {
+	points := sortedPoints(s)
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, true, 0)
+	var vals []float64
+	for _, p := range points {
+		if !missing(p.f) {
+			vals = append(vals, *p.f)
+		}
+	}
+	var median, mad float64
+	if len(vals) > 0 {
+		median = quantileFloats(vals, 0.5)
+		deviations := make([]float64, len(vals))
+		for i, v := range vals {
+			deviations[i] = math.Abs(v - median)
+		}
+		mad = madScale * quantileFloats(deviations, 0.5)
+	}
+	for i, p := range points {
+		p := p
+		var f *float64
+		if !missing(p.f) {
+			outlier := 0.0
+			if d := math.Abs(*p.f - median); (mad == 0 && d != 0) || (mad != 0 && d > threshold*mad) {
+				outlier = 1
+			}
+			f = &outlier
+		}
+		newSeries.AppendPoint(i, &p.t, f)
+	}
+	return newSeries
+}
+
+// SeasonalBaseline returns a Series where each point is the mean of the values of s at
+// the same time in the previous n periods, such as the same time of day in the previous
+// 7 days for a period of 1 day. The value of a previous period is the value of the point
+// nearest to that time, if it is within half the median time between points. See
+// SeasonalDeviation to compare the points of s to the baseline.
+//
+// Null and NaN values are ignored. If no previous period has a value the point is null.
+// Points are sorted by time and points with null times are dropped.
+func (s Series) SeasonalBaseline(period time.Duration, n int) Series {
+	points := sortedPoints(s)
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, true, 0)
+	tolerance := medianStep(points) / 2
+	for i, p := range points {
+		p := p
+		var vals []float64
+		for k := 1; k <= n; k++ {
+			if f, ok := nearestValue(points, p.t.Add(-time.Duration(k)*period), tolerance); ok && !missing(f) {
+				vals = append(vals, *f)
+			}
+		}
+		var f *float64
+		if len(vals) > 0 {
+			mean := sumFloats(vals) / float64(len(vals))
+			f = &mean
+		}
+		newSeries.AppendPoint(i, &p.t, f)
+	}
+	return newSeries
+}
+
+// SeasonalDeviation returns a Series where each point is the value of s minus its
+// SeasonalBaseline, so a point is positive when it is higher than usual for its time.
+// A point is null if its value is null or NaN, or if the baseline is null. Points are
+// sorted by time and points with null times are dropped.
+func (s Series) SeasonalDeviation(period time.Duration, n int) Series {
+	points := sortedPoints(s)
+	baseline := s.SeasonalBaseline(period, n)
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, true, 0)
+	for i, p := range points {
+		p := p
+		var f *float64
+		if _, b := baseline.GetPoint(i); !missing(p.f) && b != nil {
+			d := *p.f - *b
+			f = &d
+		}
+		newSeries.AppendPoint(i, &p.t, f)
+	}
+	return newSeries
+}
@@ -0,0 +1,131 @@
+package mathexp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnomalyFuncs(t *testing.T) {
+	// series returns a series with points every 10 seconds from 0.
+	series := func(fs ...*float64) Results {
+		points := make([]tp, len(fs))
+		for i, f := range fs {
+			points[i] = tp{time.Unix(int64(i*10), 0), f}
+		}
+		return Results{[]Value{makeSeries("", data.Labels{"host": "a"}, points...)}}
+	}
+	vars := Vars{
+		"A": series(float64Pointer(1), float64Pointer(2), float64Pointer(3), float64Pointer(10), nil, float64Pointer(2)),
+		"B": series(float64Pointer(1), float64Pointer(2), float64Pointer(3), float64Pointer(2), float64Pointer(100), nil),
+		"C": series(float64Pointer(5), float64Pointer(5), float64Pointer(5), float64Pointer(6)),
+		"E": series(float64Pointer(1), float64Pointer(2), float64Pointer(3), float64Pointer(0), nil, float64Pointer(5)),
+		"D": series(float64Pointer(1), float64Pointer(2), float64Pointer(3), float64Pointer(4), float64Pointer(5), float64Pointer(6)),
+	}
+	inf := float64Pointer(math.Inf(1))
+	var tests = []struct {
+		name      string
+		expr      string
+		execErrIs assert.ErrorAssertionFunc
+		results   Results
+	}{
+		{
+			name:      "zscore over points before each point",
+			expr:      `zscore($A, "2")`,
+			execErrIs: assert.NoError,
+			results:   series(nil, nil, float64Pointer(3), float64Pointer(15), nil, nil),
+		},
+		{
+			name:      "zscore over a duration before each point",
+			expr:      `zscore($A, "25s")`,
+			execErrIs: assert.NoError,
+			results:   series(nil, nil, float64Pointer(3), float64Pointer(15), nil, nil),
+		},
+		{
+			name:      "zscore invalid window",
+			expr:      `zscore($A, "0")`,
+			execErrIs: assert.Error,
+		},
+		{
+			name:      "mad_outliers",
+			expr:      "mad_outliers($B, 3)",
+			execErrIs: assert.NoError,
+			results:   series(float64Pointer(0), float64Pointer(0), float64Pointer(0), float64Pointer(0), float64Pointer(1), nil),
+		},
+		{
+			name:      "mad_outliers with zero deviation",
+			expr:      "mad_outliers($C, 3)",
+			execErrIs: assert.NoError,
+			results:   series(float64Pointer(0), float64Pointer(0), float64Pointer(0), float64Pointer(1)),
+		},
+		{
+			name:      "mad_outliers invalid threshold",
+			expr:      "mad_outliers($B, 0)",
+			execErrIs: assert.Error,
+		},
+		{
+			name:      "seasonal_baseline",
+			expr:      `seasonal_baseline($D, "20s", 2)`,
+			execErrIs: assert.NoError,
+			results:   series(nil, nil, float64Pointer(1), float64Pointer(2), float64Pointer(2), float64Pointer(3)),
+		},
+		{
+			name:      "zscore of a constant window",
+			expr:      `zscore($C, "3")`,
+			execErrIs: assert.NoError,
+			results:   series(nil, nil, float64Pointer(0), inf),
+		},
+		{
+			name:      "seasonal_deviation",
+			expr:      `seasonal_deviation($E, "20s", 2)`,
+			execErrIs: assert.NoError,
+			results:   series(nil, nil, float64Pointer(2), float64Pointer(-2), nil, float64Pointer(4)),
+		},
+		{
+			name:      "seasonal_baseline invalid number of periods",
+			expr:      `seasonal_baseline($D, "1d", 1.5)`,
+			execErrIs: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			res, err := e.Execute(vars)
+			tt.execErrIs(t, err)
+			if tt.results.Values == nil {
+				return
+			}
+			if diff := cmp.Diff(tt.results, res, data.FrameTestCompareOptions()...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSeasonalBaselineTolerance(t *testing.T) {
+	// The previous day's points are a few seconds off the same time of day.
+	day := time.Unix(0, 0)
+	s := makeSeries("", nil, tp{
+		day, float64Pointer(10),
+	}, tp{
+		day.Add(time.Minute + 3*time.Second), float64Pointer(20),
+	}, tp{
+		day.Add(24 * time.Hour), float64Pointer(11),
+	}, tp{
+		day.Add(24*time.Hour + time.Minute), float64Pointer(21),
+	})
+	baseline := s.SeasonalBaseline(24*time.Hour, 1)
+	if assert.Equal(t, 4, baseline.Len()) {
+		_, f := baseline.GetPoint(2)
+		assert.Equal(t, float64Pointer(10), f)
+		_, f = baseline.GetPoint(3)
+		assert.Equal(t, float64Pointer(20), f)
+	}
+}
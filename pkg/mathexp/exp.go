@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/grafana/gel-app/pkg/mathexp/parse"
+	sdklog "github.com/grafana/grafana-plugin-sdk-go/backend/log"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
 
@@ -21,9 +22,28 @@ type Expr struct {
 type State struct {
 	*Expr
 	Vars Vars
+	Options
+	// DroppedUnions are the combinations of results in binary operations that
+	// were dropped because their labels did not match.
+	DroppedUnions []DroppedUnion
 	// Could hold more properties that change behavior around:
 	//  - Unions (How many result A and many Result B in case A + B are joined)
-	//  - NaN/Null behavior
+}
+
+// Options are settings that change how an expression is executed.
+type Options struct {
+	// Join is how the points of two series are joined by time in binary operations.
+	Join JoinMode
+	// JoinTolerance is the maximum time between joined points when Join is JoinNearest.
+	JoinTolerance time.Duration
+	// NullMode is how null values are handled by functions, aggregations,
+	// and unary and binary operations.
+	NullMode NullMode
+	// Location is the timezone of functions that use the time of day or the
+	// day of a point, such as hour and business_hours. If nil, UTC is used.
+	Location *time.Location
+	// Now is the time returned by the time function. If zero, the current time is used.
+	Now time.Time
 }
 
 // Vars holds the results of datasource queries or other GEL expressions
@@ -44,11 +64,30 @@ func New(expr string, funcs ...map[string]parse.Func) (*Expr, error) {
 
 // Execute applies a parse expression to the context and executes it
 func (e *Expr) Execute(vars Vars) (r Results, err error) {
+	return e.ExecuteWithOptions(vars, Options{})
+}
+
+// ExecuteWithOptions applies a parse expression to the context and executes it
+// with the given Options.
+func (e *Expr) ExecuteWithOptions(vars Vars, opts Options) (r Results, err error) {
+	r, _, err = e.ExecuteWithNotices(vars, opts)
+	return r, err
+}
+
+// ExecuteWithNotices is like ExecuteWithOptions, but also returns notices about the
+// results, such as a warning for each binary operation with results that were dropped
+// because their labels do not match. The notices are returned even if there are no results.
+func (e *Expr) ExecuteWithNotices(vars Vars, opts Options) (r Results, notices []data.Notice, err error) {
 	s := &State{
-		Expr: e,
-		Vars: vars,
+		Expr:    e,
+		Vars:    vars,
+		Options: opts,
+	}
+	r, err = e.executeState(s)
+	if err != nil {
+		return r, nil, err
 	}
-	return e.executeState(s)
+	return r, s.droppedUnionNotices(), nil
 }
 
 func (e *Expr) executeState(s *State) (r Results, err error) {
@@ -87,6 +126,8 @@ func (e *State) walk(node parse.Node) (res Results, err error) {
 		res, err = e.walkUnary(node)
 	case *parse.FuncNode:
 		res, err = e.walkFunc(node)
+	case *parse.TernaryNode:
+		res, err = e.walkTernary(node)
 	default:
 		return res, fmt.Errorf("expr: can not walk node type: %s", node.Type())
 	}
@@ -103,19 +144,13 @@ func (e *State) walkUnary(node *parse.UnaryNode) (Results, error) {
 		var newVal Value
 		switch rt := val.(type) {
 		case Scalar:
-			newVal = NewScalar(nil)
-			f := rt.GetFloat64Value()
-			if f != nil {
-				newF, err := unaryOp(node.OpStr, *f)
-				if err != nil {
-					return newResults, err
-				}
-				newVal = NewScalar(&newF)
-			}
+			var newF *float64
+			newF, _, err = e.NullMode.unaryOp(node.OpStr, rt.GetFloat64Value())
+			newVal = NewScalar(newF)
 		case Number:
-			newVal, err = unaryNumber(rt, node.OpStr)
+			newVal, err = unaryNumber(rt, node.OpStr, e.NullMode)
 		case Series:
-			newVal, err = unarySeries(rt, node.OpStr)
+			newVal, err = unarySeries(rt, node.OpStr, e.NullMode)
 		default:
 			return newResults, fmt.Errorf("can not perform a unary operation on type %v", rt.Type())
 		}
@@ -128,34 +163,29 @@ func (e *State) walkUnary(node *parse.UnaryNode) (Results, error) {
 	return newResults, nil
 }
 
-func unarySeries(s Series, op string) (Series, error) {
-	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, s.ValueIsNullabe, s.Len())
+func unarySeries(s Series, op string, nullMode NullMode) (Series, error) {
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, s.ValueIsNullabe, 0)
 	for i := 0; i < s.Len(); i++ {
 		t, f := s.GetPoint(i)
-		if f == nil {
-			newSeries.SetPoint(i, t, nil)
-			continue
-		}
-		newF, err := unaryOp(op, *f)
+		newF, skip, err := nullMode.unaryOp(op, f)
 		if err != nil {
 			return newSeries, err
 		}
-		newSeries.SetPoint(i, t, &newF)
+		if skip {
+			continue
+		}
+		newSeries.AppendPoint(i, t, newF)
 	}
 	return newSeries, nil
 }
 
-func unaryNumber(n Number, op string) (Number, error) {
+func unaryNumber(n Number, op string, nullMode NullMode) (Number, error) {
 	newNumber := NewNumber(n.GetName(), n.GetLabels())
-
-	f := n.GetFloat64Value()
-	if f != nil {
-		newF, err := unaryOp(op, *f)
-		if err != nil {
-			return newNumber, err
-		}
-		newNumber.SetValue(&newF)
+	newF, _, err := nullMode.unaryOp(op, n.GetFloat64Value())
+	if err != nil {
+		return newNumber, err
 	}
+	newNumber.SetValue(newF)
 	return newNumber, nil
 }
 
@@ -186,14 +216,24 @@ type Union struct {
 	A, B   Value
 }
 
+// DroppedUnion is a combination of results from either side of a binary
+// operation that was dropped because their labels could not be matched.
+type DroppedUnion struct {
+	// Expr is the binary operation, e.g. "$A + $B".
+	Expr             string
+	ALabels, BLabels data.Labels
+}
+
 // union creates Union objects based on the Labels attached to each Series or Number
 // within a collection of Series or Numbers. The Unions are used with binary
 // operations. The labels of the Union will the taken from result with a greater
-// number of tags.
-func union(aResults, bResults Results) []*Union {
+// number of tags. The combinations of results that could not be joined are
+// returned as DroppedUnions.
+func union(aResults, bResults Results) ([]*Union, []DroppedUnion) {
 	unions := []*Union{}
+	var dropped []DroppedUnion
 	if len(aResults.Values) == 0 || len(bResults.Values) == 0 {
-		return unions
+		return unions, dropped
 	}
 	for _, a := range aResults.Values {
 		for _, b := range bResults.Values {
@@ -207,12 +247,15 @@ func union(aResults, bResults Results) []*Union {
 				}
 				labels = l
 			} else if len(aLabels) == len(bLabels) {
-				continue // invalid union, drop for now
+				// invalid union, drop for now
+				dropped = append(dropped, DroppedUnion{ALabels: aLabels, BLabels: bLabels})
+				continue
 			} else if aLabels.Contains(bLabels) {
 				labels = aLabels
 			} else if bLabels.Contains(aLabels) {
 				labels = bLabels
 			} else {
+				dropped = append(dropped, DroppedUnion{ALabels: aLabels, BLabels: bLabels})
 				continue
 			}
 			u := &Union{
@@ -233,8 +276,37 @@ func union(aResults, bResults Results) []*Union {
 			A: aResults.Values[0],
 			B: bResults.Values[0],
 		})
+		dropped = nil
 	}
-	return unions
+	return unions, dropped
+}
+
+// droppedUnionNotices returns a warning notice per binary operation summarizing
+// the DroppedUnions, and logs the full details at debug level. It returns nil if
+// nothing was dropped.
+func (e *State) droppedUnionNotices() []data.Notice {
+	if len(e.DroppedUnions) == 0 {
+		return nil
+	}
+	var exprs []string
+	byExpr := make(map[string][]DroppedUnion)
+	for _, d := range e.DroppedUnions {
+		if _, ok := byExpr[d.Expr]; !ok {
+			exprs = append(exprs, d.Expr)
+		}
+		byExpr[d.Expr] = append(byExpr[d.Expr], d)
+		sdklog.DefaultLogger.Debug("Dropped union in GEL binary operation", "expr", d.Expr, "a", d.ALabels.String(), "b", d.BLabels.String())
+	}
+	notices := make([]data.Notice, len(exprs))
+	for i, expr := range exprs {
+		d := byExpr[expr]
+		notices[i] = data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text: fmt.Sprintf("%v combination(s) of results in %v were dropped because their labels do not match, e.g. {%v} and {%v}",
+				len(d), expr, d[0].ALabels, d[0].BLabels),
+		}
+	}
+	return notices
 }
 
 func (e *State) walkBinary(node *parse.BinaryNode) (Results, error) {
@@ -247,7 +319,20 @@ func (e *State) walkBinary(node *parse.BinaryNode) (Results, error) {
 	if err != nil {
 		return res, err
 	}
-	unions := union(ar, br)
+	var unions []*Union
+	var dropped []DroppedUnion
+	if node.Matching != nil {
+		unions, dropped, err = matchUnion(ar, br, node.Matching)
+		if err != nil {
+			return res, err
+		}
+	} else {
+		unions, dropped = union(ar, br)
+	}
+	for _, d := range dropped {
+		d.Expr = node.String()
+		e.DroppedUnions = append(e.DroppedUnions, d)
+	}
 	for _, uni := range unions {
 		name := uni.Labels.String()
 		var value Value
@@ -257,25 +342,15 @@ func (e *State) walkBinary(node *parse.BinaryNode) (Results, error) {
 			switch bt := uni.B.(type) {
 			// Scalar op Scalar
 			case Scalar:
-				bFloat := bt.GetFloat64Value()
-				if aFloat == nil || bFloat == nil {
-					value = NewScalar(nil)
-					break
-				}
-				f := math.NaN()
-				if aFloat != nil && bFloat != nil {
-					f, err = binaryOp(node.OpStr, *aFloat, *bFloat)
-					if err != nil {
-						return res, err
-					}
-				}
-				value = NewScalar(&f)
+				var f *float64
+				f, _, err = e.NullMode.binaryOp(node.OpStr, aFloat, bt.GetFloat64Value())
+				value = NewScalar(f)
 			// Scalar op Scalar
 			case Number:
-				value, err = biScalarNumber(name, uni.Labels, node.OpStr, bt, aFloat, false)
+				value, err = biScalarNumber(name, uni.Labels, node.OpStr, bt, aFloat, false, e.NullMode)
 			// Scalar op Series
 			case Series:
-				value, err = biSeriesNumber(name, uni.Labels, node.OpStr, bt, aFloat, false)
+				value, err = biSeriesNumber(name, uni.Labels, node.OpStr, bt, aFloat, false, e.NullMode)
 			default:
 				return res, fmt.Errorf("not implemented: binary %v on %T and %T", node.OpStr, uni.A, uni.B)
 			}
@@ -284,14 +359,18 @@ func (e *State) walkBinary(node *parse.BinaryNode) (Results, error) {
 			// Series Op Scalar
 			case Scalar:
 				bFloat := bt.GetFloat64Value()
-				value, err = biSeriesNumber(name, uni.Labels, node.OpStr, at, bFloat, true)
+				value, err = biSeriesNumber(name, uni.Labels, node.OpStr, at, bFloat, true, e.NullMode)
 			// case Series Op Number
 			case Number:
 				bFloat := bt.GetFloat64Value()
-				value, err = biSeriesNumber(name, uni.Labels, node.OpStr, at, bFloat, true)
+				value, err = biSeriesNumber(name, uni.Labels, node.OpStr, at, bFloat, true, e.NullMode)
 			// case Series op Series
 			case Series:
-				value, err = biSeriesSeries(name, uni.Labels, node.OpStr, at, bt)
+				if e.Join == JoinInner {
+					value, err = biSeriesSeries(name, uni.Labels, node.OpStr, at, bt, e.NullMode)
+				} else {
+					value, err = biSeriesSeriesJoin(name, uni.Labels, node.OpStr, at, bt, e.Options)
+				}
 			default:
 				return res, fmt.Errorf("not implemented: binary %v on %T and %T", node.OpStr, uni.A, uni.B)
 			}
@@ -300,12 +379,12 @@ func (e *State) walkBinary(node *parse.BinaryNode) (Results, error) {
 			switch bt := uni.B.(type) {
 			case Scalar:
 				bFloat := bt.GetFloat64Value()
-				value, err = biScalarNumber(name, uni.Labels, node.OpStr, at, bFloat, true)
+				value, err = biScalarNumber(name, uni.Labels, node.OpStr, at, bFloat, true, e.NullMode)
 			case Number:
 				bFloat := bt.GetFloat64Value()
-				value, err = biScalarNumber(name, uni.Labels, node.OpStr, at, bFloat, true)
+				value, err = biScalarNumber(name, uni.Labels, node.OpStr, at, bFloat, true, e.NullMode)
 			case Series:
-				value, err = biSeriesNumber(name, uni.Labels, node.OpStr, bt, aFloat, false)
+				value, err = biSeriesNumber(name, uni.Labels, node.OpStr, bt, aFloat, false, e.NullMode)
 			default:
 				return res, fmt.Errorf("not implemented: binary %v on %T and %T", node.OpStr, uni.A, uni.B)
 			}
@@ -333,6 +412,11 @@ func binaryOp(op string, a, b float64) (r float64, err error) {
 		if a == 0 {
 			return 0, nil
 		}
+	case "??":
+		if math.IsNaN(a) {
+			return b, nil
+		}
+		return a, nil
 	}
 	if math.IsNaN(a) || math.IsNaN(b) {
 		return math.NaN(), nil
@@ -404,46 +488,42 @@ func binaryOp(op string, a, b float64) (r float64, err error) {
 	return
 }
 
-func biScalarNumber(name string, labels data.Labels, op string, number Number, scalarVal *float64, numberFirst bool) (Number, error) {
+func biScalarNumber(name string, labels data.Labels, op string, number Number, scalarVal *float64, numberFirst bool, nullMode NullMode) (Number, error) {
 	newNumber := NewNumber(name, labels)
 	f := number.GetFloat64Value()
-	if f == nil || scalarVal == nil {
-		newNumber.SetValue(nil)
-		return newNumber, nil
-	}
-	nF := math.NaN()
+	var nF *float64
 	var err error
 	if numberFirst {
-		nF, err = binaryOp(op, *f, *scalarVal)
+		nF, _, err = nullMode.binaryOp(op, f, scalarVal)
 	} else {
-		nF, err = binaryOp(op, *scalarVal, *f)
+		nF, _, err = nullMode.binaryOp(op, scalarVal, f)
 	}
 	if err != nil {
 		return newNumber, err
 	}
-	newNumber.SetValue(&nF)
+	newNumber.SetValue(nF)
 	return newNumber, nil
 }
 
-func biSeriesNumber(name string, labels data.Labels, op string, s Series, scalarVal *float64, seriesFirst bool) (Series, error) {
-	newSeries := NewSeries(name, labels, s.TimeIdx, s.TimeIsNullable, s.ValueIdx, s.ValueIsNullabe, s.Len())
-	var err error
+func biSeriesNumber(name string, labels data.Labels, op string, s Series, scalarVal *float64, seriesFirst bool, nullMode NullMode) (Series, error) {
+	newSeries := NewSeries(name, labels, s.TimeIdx, s.TimeIsNullable, s.ValueIdx, s.ValueIsNullabe, 0)
 	for i := 0; i < s.Len(); i++ {
-		nF := math.NaN()
+		var nF *float64
+		var skip bool
+		var err error
 		t, f := s.GetPoint(i)
-		if f == nil || scalarVal == nil {
-			newSeries.SetPoint(i, t, nil)
-			continue
-		}
 		if seriesFirst {
-			nF, err = binaryOp(op, *f, *scalarVal)
+			nF, skip, err = nullMode.binaryOp(op, f, scalarVal)
 		} else {
-			nF, err = binaryOp(op, *scalarVal, *f)
+			nF, skip, err = nullMode.binaryOp(op, scalarVal, f)
 		}
 		if err != nil {
 			return newSeries, err
 		}
-		newSeries.SetPoint(i, t, &nF)
+		if skip {
+			continue
+		}
+		newSeries.AppendPoint(i, t, nF)
 	}
 	return newSeries, nil
 }
@@ -451,7 +531,8 @@ func biSeriesNumber(name string, labels data.Labels, op string, s Series, scalar
 // ... if would you like some series with your series and then get some series, or is that enough series?
 // biSeriesSeries performs a the binary operation for each value in the two series where the times
 // are equal. If there are datapoints in A or B that do not share a time, they will be dropped.
-func biSeriesSeries(name string, labels data.Labels, op string, aSeries, bSeries Series) (Series, error) {
+// This is the JoinInner join mode, see biSeriesSeriesJoin for the other join modes.
+func biSeriesSeries(name string, labels data.Labels, op string, aSeries, bSeries Series, nullMode NullMode) (Series, error) {
 	bPoints := make(map[time.Time]*float64)
 	for i := 0; i < bSeries.Len(); i++ {
 		t, f := bSeries.GetPoint(i)
@@ -467,24 +548,36 @@ func biSeriesSeries(name string, labels data.Labels, op string, aSeries, bSeries
 		if !ok {
 			continue
 		}
-		if aF == nil || bF == nil {
-			newSeries.AppendPoint(aIdx, aTime, nil)
-			continue
-		}
-		nF, err := binaryOp(op, *aF, *bF)
+		nF, skip, err := nullMode.binaryOp(op, aF, bF)
 		if err != nil {
 			return newSeries, err
 		}
-		newSeries.AppendPoint(aIdx, aTime, &nF)
+		if skip {
+			continue
+		}
+		newSeries.AppendPoint(aIdx, aTime, nF)
 	}
 	return newSeries, nil
 }
 
+// scalarArg returns the value of Results that holds a single Scalar.
+// A null value is NaN.
+func scalarArg(r Results) (float64, error) {
+	if len(r.Values) != 1 || r.Values[0].Type() != parse.TypeScalar {
+		return 0, fmt.Errorf("expr: expected a scalar argument")
+	}
+	f := r.Values[0].(Scalar).GetFloat64Value()
+	if f == nil {
+		return math.NaN(), nil
+	}
+	return *f, nil
+}
+
 func (e *State) walkFunc(node *parse.FuncNode) (Results, error) {
 	var res Results
 	var err error
 	var in []reflect.Value
-	for _, a := range node.Args {
+	for i, a := range node.Args {
 		var v interface{}
 		switch t := a.(type) {
 		case *parse.StringNode:
@@ -499,12 +592,28 @@ func (e *State) walkFunc(node *parse.FuncNode) (Results, error) {
 			v, err = e.walkUnary(t)
 		case *parse.BinaryNode:
 			v, err = e.walkBinary(t)
+		case *parse.TernaryNode:
+			v, err = e.walkTernary(t)
 		default:
 			return res, fmt.Errorf("expr: unknown func arg type: %T", t)
 		}
 		if err != nil {
 			return res, err
 		}
+		// Scalar arguments that are expressions, such as -1, are evaluated to Results,
+		// and scalars passed as a set, such as the 1 in abs(1), are a float64.
+		switch r := v.(type) {
+		case Results:
+			if node.F.Args[i] == parse.TypeScalar {
+				if v, err = scalarArg(r); err != nil {
+					return res, err
+				}
+			}
+		case float64:
+			if node.F.Args[i] != parse.TypeScalar {
+				v = NewScalarResults(&r)
+			}
+		}
 		in = append(in, reflect.ValueOf(v))
 	}
 
@@ -0,0 +1,76 @@
+package mathexp
+
+import "math"
+
+// Fill returns a Series where the null and NaN values of s are replaced with v.
+// Points are sorted by time and points with null times are dropped.
+func (s Series) Fill(v float64) Series {
+	return s.fill(func(points []point, i, prev, next int) *float64 {
+		return &v
+	})
+}
+
+// FillPrevious returns a Series where the null and NaN values of s are replaced with
+// the previous value that is not null or NaN. Values before the first such value are
+// not filled. Points are sorted by time and points with null times are dropped.
+func (s Series) FillPrevious() Series {
+	return s.fill(func(points []point, i, prev, next int) *float64 {
+		if prev < 0 {
+			return points[i].f
+		}
+		return points[prev].f
+	})
+}
+
+// FillLinear returns a Series where the null and NaN values of s are interpolated by
+// time between the values either side that are not null or NaN. Values before the first
+// or after the last such value are not filled. Points are sorted by time and points with
+// null times are dropped.
+func (s Series) FillLinear() Series {
+	return s.fill(func(points []point, i, prev, next int) *float64 {
+		if prev < 0 || next < 0 {
+			return points[i].f
+		}
+		p, n := points[prev], points[next]
+		if !n.t.After(p.t) {
+			return p.f
+		}
+		ratio := float64(points[i].t.Sub(p.t)) / float64(n.t.Sub(p.t))
+		f := *p.f + ratio*(*n.f-*p.f)
+		return &f
+	})
+}
+
+// fill returns a Series with the points of s, where the value of each point that is
+// null or NaN is replaced with the value returned by fillF for its index in points.
+// prev and next are the indexes of the points before and after it whose values are
+// not null or NaN, or -1 if there is no such point.
+func (s Series) fill(fillF func(points []point, i, prev, next int) *float64) Series {
+	points := sortedPoints(s)
+	next := make([]int, len(points))
+	n := -1
+	for i := len(points) - 1; i >= 0; i-- {
+		next[i] = n
+		if !missing(points[i].f) {
+			n = i
+		}
+	}
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, true, 0)
+	prev := -1
+	for i, p := range points {
+		p := p
+		f := p.f
+		if missing(f) {
+			f = fillF(points, i, prev, next[i])
+		} else {
+			prev = i
+		}
+		newSeries.AppendPoint(i, &p.t, f)
+	}
+	return newSeries
+}
+
+// missing returns true if f is null or NaN.
+func missing(f *float64) bool {
+	return f == nil || math.IsNaN(*f)
+}
@@ -0,0 +1,129 @@
+package mathexp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFillFuncs(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeSeries("", nil, tp{
+					time.Unix(0, 0), nil,
+				}, tp{
+					time.Unix(10, 0), float64Pointer(1),
+				}, tp{
+					time.Unix(20, 0), nil,
+				}, tp{
+					time.Unix(30, 0), NaN,
+				}, tp{
+					time.Unix(40, 0), float64Pointer(7),
+				}, tp{
+					time.Unix(50, 0), nil,
+				}),
+			},
+		},
+		"B": Results{
+			[]Value{
+				makeSeries("", nil, tp{
+					time.Unix(0, 0), float64Pointer(-1),
+				}, tp{
+					time.Unix(10, 0), float64Pointer(-2),
+				}, tp{
+					time.Unix(20, 0), nil,
+				}, tp{
+					time.Unix(30, 0), float64Pointer(-4),
+				}, tp{
+					time.Unix(40, 0), float64Pointer(-5),
+				}, tp{
+					time.Unix(50, 0), float64Pointer(-6),
+				}),
+			},
+		},
+		"N":    Results{[]Value{makeNumber("", nil, float64Pointer(2))}},
+		"Null": Results{[]Value{makeNumber("", nil, nil)}},
+	}
+	expected := func(fs ...*float64) Results {
+		points := make([]tp, len(fs))
+		for i, f := range fs {
+			points[i] = tp{time.Unix(int64(i*10), 0), f}
+		}
+		return Results{[]Value{makeSeries("", nil, points...)}}
+	}
+	var tests = []struct {
+		name     string
+		expr     string
+		nullMode NullMode
+		results  Results
+	}{
+		{
+			name:    "fill",
+			expr:    "fill($A, 0)",
+			results: expected(float64Pointer(0), float64Pointer(1), float64Pointer(0), float64Pointer(0), float64Pointer(7), float64Pointer(0)),
+		},
+		{
+			name:    "fill_previous does not fill before the first value",
+			expr:    "fill_previous($A)",
+			results: expected(nil, float64Pointer(1), float64Pointer(1), float64Pointer(1), float64Pointer(7), float64Pointer(7)),
+		},
+		{
+			name:    "fill_linear does not fill outside the values",
+			expr:    "fill_linear($A)",
+			results: expected(nil, float64Pointer(1), float64Pointer(3), float64Pointer(5), float64Pointer(7), nil),
+		},
+		{
+			name:    "coalesce series with series",
+			expr:    "$A ?? $B",
+			results: expected(float64Pointer(-1), float64Pointer(1), nil, float64Pointer(-4), float64Pointer(7), float64Pointer(-6)),
+		},
+		{
+			name:    "coalesce series with scalar",
+			expr:    "$A ?? 0",
+			results: expected(float64Pointer(0), float64Pointer(1), float64Pointer(0), float64Pointer(0), float64Pointer(7), float64Pointer(0)),
+		},
+		{
+			name:     "coalesce ignores the null mode",
+			expr:     "$A ?? 0",
+			nullMode: NullModeSkip,
+			results:  expected(float64Pointer(0), float64Pointer(1), float64Pointer(0), float64Pointer(0), float64Pointer(7), float64Pointer(0)),
+		},
+		{
+			name:    "coalesce is left associative",
+			expr:    "$A ?? $B ?? 0",
+			results: expected(float64Pointer(-1), float64Pointer(1), float64Pointer(0), float64Pointer(-4), float64Pointer(7), float64Pointer(-6)),
+		},
+		{
+			name:    "coalesce null number",
+			expr:    "$Null ?? $N",
+			results: Results{[]Value{makeNumber("", nil, float64Pointer(2))}},
+		},
+		{
+			name:    "coalesce keeps a number that is not null",
+			expr:    "$N ?? $Null",
+			results: Results{[]Value{makeNumber("", nil, float64Pointer(2))}},
+		},
+	}
+	opt := cmp.Comparer(func(x, y float64) bool {
+		return (math.IsNaN(x) && math.IsNaN(y)) || x == y
+	})
+	options := append([]cmp.Option{opt}, data.FrameTestCompareOptions()...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			res, err := e.ExecuteWithOptions(vars, Options{NullMode: tt.nullMode})
+			assert.NoError(t, err)
+			if diff := cmp.Diff(tt.results, res, options...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
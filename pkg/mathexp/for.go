@@ -0,0 +1,105 @@
+package mathexp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Window is a span over a Series that is either a number of points
+// or a time duration. Only one of Points or Duration is set.
+type Window struct {
+	Points   int
+	Duration time.Duration
+}
+
+// ParseWindow parses a window string. A plain integer (e.g. "5") is a number
+// of points, anything else is parsed as a duration (e.g. "10m" or "1d"), see ParseDuration.
+func ParseWindow(s string) (Window, error) {
+	var w Window
+	if points, err := strconv.Atoi(s); err == nil {
+		if points <= 0 {
+			return w, fmt.Errorf("window must be a positive number of points, got %v", points)
+		}
+		w.Points = points
+		return w, nil
+	}
+	d, err := ParseDuration(s)
+	if err != nil {
+		return w, fmt.Errorf("window %q is neither a number of points nor a duration", s)
+	}
+	if d <= 0 {
+		return w, fmt.Errorf("window must be a positive duration, got %v", d)
+	}
+	w.Duration = d
+	return w, nil
+}
+
+// String returns the string representation of the Window.
+func (w Window) String() string {
+	if w.Points > 0 {
+		return strconv.Itoa(w.Points)
+	}
+	return w.Duration.String()
+}
+
+// For returns a Series with the same times as s where each point is 1 if the
+// value of s has been true (non-zero) continuously for at least the window,
+// and 0 otherwise.
+//
+// When the window is a duration, the condition holds once the time between
+// the first point of the current run of true values and the current point is
+// at least the duration. When the window is a number of points, the condition
+// holds once the current run has at least that many points.
+//
+// Null and NaN values (as well as null times) are treated as false: they
+// output 0 and reset the run. The series is expected to be sorted by time
+// ascending.
+func (s Series) For(w Window) Series {
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, s.ValueIsNullabe, s.Len())
+	var runStart *time.Time
+	runLength := 0
+	for i := 0; i < s.Len(); i++ {
+		t, f := s.GetPoint(i)
+		held := 0.0
+		if t == nil || f == nil || math.IsNaN(*f) || *f == 0 {
+			runStart = nil
+			runLength = 0
+		} else {
+			if runStart == nil {
+				runStart = t
+			}
+			runLength++
+			if w.Points > 0 && runLength >= w.Points {
+				held = 1
+			}
+			if w.Duration > 0 && t.Sub(*runStart) >= w.Duration {
+				held = 1
+			}
+		}
+		newSeries.SetPoint(i, t, &held)
+	}
+	return newSeries
+}
+
+// ForNumber returns a Number that is 1 if the condition in s has held for the
+// window as of the last point in s, and 0 otherwise. See For for how the
+// condition is evaluated.
+func (s Series) ForNumber(w Window) Number {
+	var l data.Labels
+	if s.GetLabels() != nil {
+		l = s.GetLabels().Copy()
+	}
+	number := NewNumber(fmt.Sprintf("for_%v", s.GetName()), l)
+	held := 0.0
+	if s.Len() > 0 {
+		if f := s.For(w).GetValue(s.Len() - 1); f != nil {
+			held = *f
+		}
+	}
+	number.SetValue(&held)
+	return number
+}
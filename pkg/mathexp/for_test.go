@@ -0,0 +1,188 @@
+package mathexp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var conditionSeries = makeSeries("", data.Labels{"host": "a"}, tp{
+	time.Unix(0, 0), float64Pointer(1),
+}, tp{
+	time.Unix(60, 0), float64Pointer(1),
+}, tp{
+	time.Unix(120, 0), float64Pointer(1),
+}, tp{
+	time.Unix(180, 0), nil,
+}, tp{
+	time.Unix(240, 0), float64Pointer(1),
+}, tp{
+	time.Unix(300, 0), float64Pointer(math.NaN()),
+}, tp{
+	time.Unix(360, 0), float64Pointer(0),
+})
+
+func TestParseWindow(t *testing.T) {
+	var tests = []struct {
+		name   string
+		window string
+		errIs  assert.ErrorAssertionFunc
+		result Window
+	}{
+		{
+			name:   "integer is a number of points",
+			window: "5",
+			errIs:  assert.NoError,
+			result: Window{Points: 5},
+		},
+		{
+			name:   "duration string is a duration",
+			window: "10m",
+			errIs:  assert.NoError,
+			result: Window{Duration: 10 * time.Minute},
+		},
+		{
+			name:   "zero points should error",
+			window: "0",
+			errIs:  assert.Error,
+		},
+		{
+			name:   "negative duration should error",
+			window: "-1m",
+			errIs:  assert.Error,
+		},
+		{
+			name:   "invalid window should error",
+			window: "foo",
+			errIs:  assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := ParseWindow(tt.window)
+			tt.errIs(t, err)
+			if err == nil {
+				assert.Equal(t, tt.result, w)
+			}
+		})
+	}
+}
+
+func TestSeriesFor(t *testing.T) {
+	var tests = []struct {
+		name   string
+		window Window
+		series Series
+		result Series
+	}{
+		{
+			name:   "points window, null and NaN reset the run",
+			window: Window{Points: 2},
+			series: conditionSeries,
+			result: makeSeries("", data.Labels{"host": "a"}, tp{
+				time.Unix(0, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(60, 0), float64Pointer(1),
+			}, tp{
+				time.Unix(120, 0), float64Pointer(1),
+			}, tp{
+				time.Unix(180, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(240, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(300, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(360, 0), float64Pointer(0),
+			}),
+		},
+		{
+			name:   "duration window counts from the start of the run",
+			window: Window{Duration: 2 * time.Minute},
+			series: conditionSeries,
+			result: makeSeries("", data.Labels{"host": "a"}, tp{
+				time.Unix(0, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(60, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(120, 0), float64Pointer(1),
+			}, tp{
+				time.Unix(180, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(240, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(300, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(360, 0), float64Pointer(0),
+			}),
+		},
+		{
+			name:   "empty series",
+			window: Window{Points: 1},
+			series: makeSeries("", nil),
+			result: makeSeries("", nil),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := tt.series.For(tt.window)
+			if diff := cmp.Diff(tt.result, res, data.FrameTestCompareOptions()...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSeriesForNumber(t *testing.T) {
+	held := makeSeries("", nil, tp{
+		time.Unix(0, 0), float64Pointer(1),
+	}, tp{
+		time.Unix(60, 0), float64Pointer(1),
+	})
+	require.Equal(t, makeNumber("for_", nil, float64Pointer(1)), held.ForNumber(Window{Duration: time.Minute}))
+	require.Equal(t, makeNumber("for_", nil, float64Pointer(0)), held.ForNumber(Window{Duration: 2 * time.Minute}))
+	require.Equal(t, makeNumber("for_", nil, float64Pointer(0)), makeSeries("", nil).ForNumber(Window{Points: 1}))
+}
+
+func TestForFunc(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeSeries("", nil, tp{
+					time.Unix(0, 0), float64Pointer(95),
+				}, tp{
+					time.Unix(60, 0), float64Pointer(99),
+				}, tp{
+					time.Unix(120, 0), float64Pointer(80),
+				}),
+			},
+		},
+	}
+	e, err := New(`for($A > 90, "2")`)
+	require.NoError(t, err)
+	res, err := e.Execute(vars)
+	require.NoError(t, err)
+	expected := Results{
+		[]Value{
+			makeSeries("", nil, tp{
+				time.Unix(0, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(60, 0), float64Pointer(1),
+			}, tp{
+				time.Unix(120, 0), float64Pointer(0),
+			}),
+		},
+	}
+	if diff := cmp.Diff(expected, res, data.FrameTestCompareOptions()...); diff != "" {
+		t.Errorf("Result mismatch (-want +got):\n%s", diff)
+	}
+
+	e, err = New(`for($A > 90, "foo")`)
+	require.NoError(t, err)
+	_, err = e.Execute(vars)
+	require.Error(t, err)
+}
@@ -0,0 +1,164 @@
+package mathexp
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaxForecastPoints is the maximum number of forecast points of a series, so that a
+// long horizon over a dense series does not make millions of points.
+const MaxForecastPoints = 10000
+
+// PredictLinear returns a Series of the least squares regression line of the non-null
+// values of s. The Series has a point for each point of s, followed by forecast points
+// up to horizon after the last point, spaced by the median time between the points of s.
+// If s has fewer than two non-null values at different times the values are null and
+// there are no forecast points. Points are sorted by time and points with null times
+// are dropped. It returns an error if there would be more than MaxForecastPoints
+// forecast points.
+func (s Series) PredictLinear(horizon time.Duration) (Series, error) {
+	points := sortedPoints(s)
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, true, 0)
+	slope, intercept, ok := linearRegression(points)
+	valueAt := func(t time.Time) *float64 {
+		if !ok {
+			return nil
+		}
+		f := intercept + slope*t.Sub(points[0].t).Seconds()
+		return &f
+	}
+	for _, p := range points {
+		p := p
+		newSeries.AppendPoint(newSeries.Len(), &p.t, valueAt(p.t))
+	}
+	if ok {
+		times, err := futureTimes(points, horizon)
+		if err != nil {
+			return s, err
+		}
+		for _, t := range times {
+			t := t
+			newSeries.AppendPoint(newSeries.Len(), &t, valueAt(t))
+		}
+	}
+	return newSeries, nil
+}
+
+// linearRegression returns the slope per second and the intercept at the time of the
+// first point of the least squares line of the non-null values of points. ok is false
+// if there are fewer than two non-null values at different times.
+func linearRegression(points []point) (slope, intercept float64, ok bool) {
+	var n, sumX, sumY, sumXY, sumX2 float64
+	for _, p := range points {
+		if p.f == nil {
+			continue
+		}
+		x := p.t.Sub(points[0].t).Seconds()
+		n++
+		sumX += x
+		sumY += *p.f
+		sumXY += x * *p.f
+		sumX2 += x * x
+	}
+	d := n*sumX2 - sumX*sumX
+	if n < 2 || d == 0 {
+		return 0, 0, false
+	}
+	slope = (n*sumXY - sumX*sumY) / d
+	intercept = (sumY - slope*sumX) / n
+	return slope, intercept, true
+}
+
+// HoltWinters returns a Series of the values of s smoothed with double exponential
+// smoothing, where sf is the smoothing factor of the level and tf is the smoothing
+// factor of the trend, both in (0, 1). The trend starts as the difference between the
+// first two non-null values. Null values do not update the smoothing and stay null.
+//
+// The Series has a point for each point of s, followed by forecast points up to horizon
+// after the last point, spaced by the median time between the points of s, where each
+// step continues the last trend. If s has fewer than two non-null values the values are
+// null and there are no forecast points. Points are sorted by time and points with null
+// times are dropped. It returns an error if there would be more than MaxForecastPoints
+// forecast points.
+func (s Series) HoltWinters(sf, tf float64, horizon time.Duration) (Series, error) {
+	points := sortedPoints(s)
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, true, 0)
+
+	var vals []float64
+	for _, p := range points {
+		if p.f != nil {
+			vals = append(vals, *p.f)
+		}
+	}
+	if len(vals) < 2 {
+		for _, p := range points {
+			p := p
+			newSeries.AppendPoint(newSeries.Len(), &p.t, nil)
+		}
+		return newSeries, nil
+	}
+
+	level, trend := vals[0], vals[1]-vals[0]
+	seen := 0
+	for _, p := range points {
+		p := p
+		if p.f == nil {
+			newSeries.AppendPoint(newSeries.Len(), &p.t, nil)
+			continue
+		}
+		if seen > 0 {
+			prevLevel := level
+			level = sf**p.f + (1-sf)*(level+trend)
+			trend = tf*(level-prevLevel) + (1-tf)*trend
+		}
+		seen++
+		f := level
+		newSeries.AppendPoint(newSeries.Len(), &p.t, &f)
+	}
+	times, err := futureTimes(points, horizon)
+	if err != nil {
+		return s, err
+	}
+	for i, t := range times {
+		t := t
+		f := level + float64(i+1)*trend
+		newSeries.AppendPoint(newSeries.Len(), &t, &f)
+	}
+	return newSeries, nil
+}
+
+// futureTimes returns the times after the last of points up to horizon after it, spaced
+// by the median time between points. It returns nil if points has fewer than two times,
+// and an error if there would be more than MaxForecastPoints times.
+func futureTimes(points []point, horizon time.Duration) ([]time.Time, error) {
+	step := medianStep(points)
+	if step <= 0 {
+		return nil, nil
+	}
+	if n := horizon / step; n > MaxForecastPoints {
+		return nil, fmt.Errorf("forecast horizon %v is %v points of %v, more than the maximum of %v", horizon, int64(n), step, MaxForecastPoints)
+	}
+	var times []time.Time
+	last := points[len(points)-1].t
+	for t := last.Add(step); !t.After(last.Add(horizon)); t = t.Add(step) {
+		times = append(times, t)
+	}
+	return times, nil
+}
+
+// medianStep returns the median time between consecutive points, which must be sorted
+// by time. Points at the same time are ignored. It returns 0 if there are no steps.
+func medianStep(points []point) time.Duration {
+	var steps []time.Duration
+	for i := 1; i < len(points); i++ {
+		if d := points[i].t.Sub(points[i-1].t); d > 0 {
+			steps = append(steps, d)
+		}
+	}
+	if len(steps) == 0 {
+		return 0
+	}
+	sort.Slice(steps, func(i, j int) bool { return steps[i] < steps[j] })
+	return steps[len(steps)/2]
+}
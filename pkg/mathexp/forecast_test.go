@@ -0,0 +1,136 @@
+package mathexp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForecastFuncs(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeSeries("", data.Labels{"host": "a"}, tp{
+					time.Unix(0, 0), float64Pointer(1),
+				}, tp{
+					time.Unix(10, 0), float64Pointer(3),
+				}, tp{
+					time.Unix(20, 0), nil,
+				}, tp{
+					time.Unix(30, 0), float64Pointer(7),
+				}),
+			},
+		},
+		"B": Results{
+			[]Value{
+				makeSeries("", data.Labels{"host": "b"}, tp{
+					time.Unix(0, 0), float64Pointer(1),
+				}, tp{
+					time.Unix(10, 0), float64Pointer(2),
+				}, tp{
+					time.Unix(20, 0), float64Pointer(4),
+				}),
+			},
+		},
+		"One": Results{
+			[]Value{
+				makeSeries("", nil, tp{
+					time.Unix(0, 0), float64Pointer(1),
+				}, tp{
+					time.Unix(10, 0), nil,
+				}),
+			},
+		},
+	}
+	// series returns a series with points every 10 seconds from 0.
+	series := func(labels data.Labels, fs ...*float64) Results {
+		points := make([]tp, len(fs))
+		for i, f := range fs {
+			points[i] = tp{time.Unix(int64(i*10), 0), f}
+		}
+		return Results{[]Value{makeSeries("", labels, points...)}}
+	}
+	var tests = []struct {
+		name      string
+		expr      string
+		execErrIs assert.ErrorAssertionFunc
+		results   Results
+	}{
+		{
+			name:      "predict_linear fits the points",
+			expr:      `predict_linear($A, "0s")`,
+			execErrIs: assert.NoError,
+			results:   series(data.Labels{"host": "a"}, float64Pointer(1), float64Pointer(3), float64Pointer(5), float64Pointer(7)),
+		},
+		{
+			name:      "predict_linear forecasts up to the horizon",
+			expr:      `predict_linear($A, "25s")`,
+			execErrIs: assert.NoError,
+			results: series(data.Labels{"host": "a"}, float64Pointer(1), float64Pointer(3), float64Pointer(5), float64Pointer(7),
+				float64Pointer(9), float64Pointer(11)),
+		},
+		{
+			name:      "predict_linear with one value is null",
+			expr:      `predict_linear($One, "1h")`,
+			execErrIs: assert.NoError,
+			results:   series(nil, nil, nil),
+		},
+		{
+			name:      "predict_linear negative horizon",
+			expr:      `predict_linear($A, "-1h")`,
+			execErrIs: assert.Error,
+		},
+		{
+			name:      "predict_linear too many forecast points",
+			expr:      `predict_linear($A, "1w")`,
+			execErrIs: assert.Error,
+		},
+		{
+			name:      "holt_winters smooths the points",
+			expr:      "holt_winters($B, 0.5, 0.5)",
+			execErrIs: assert.NoError,
+			results:   series(data.Labels{"host": "b"}, float64Pointer(1), float64Pointer(2), float64Pointer(3.5)),
+		},
+		{
+			name:      "holt_winters_forecast continues the trend",
+			expr:      `holt_winters_forecast($B, 0.5, 0.5, "20s")`,
+			execErrIs: assert.NoError,
+			results:   series(data.Labels{"host": "b"}, float64Pointer(1), float64Pointer(2), float64Pointer(3.5), float64Pointer(4.75), float64Pointer(6)),
+		},
+		{
+			name:      "holt_winters keeps null points",
+			expr:      "holt_winters($A, 0.5, 0.5)",
+			execErrIs: assert.NoError,
+			results:   series(data.Labels{"host": "a"}, float64Pointer(1), float64Pointer(3), nil, float64Pointer(6)),
+		},
+		{
+			name:      "holt_winters_forecast too many forecast points",
+			expr:      `holt_winters_forecast($B, 0.5, 0.5, "1w")`,
+			execErrIs: assert.Error,
+		},
+		{
+			name:      "holt_winters invalid smoothing factor",
+			expr:      "holt_winters($B, 1, 0.5)",
+			execErrIs: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			res, err := e.Execute(vars)
+			tt.execErrIs(t, err)
+			if tt.results.Values == nil {
+				return
+			}
+			if diff := cmp.Diff(tt.results, res, data.FrameTestCompareOptions()...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package mathexp
 
 import (
+	"fmt"
 	"math"
+	"time"
 
 	"github.com/grafana/gel-app/pkg/mathexp/parse"
 )
@@ -17,6 +19,96 @@ var builtins = map[string]parse.Func{
 		VariantReturn: true,
 		F:             log,
 	},
+	"ceil": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             mathFunc(math.Ceil),
+	},
+	"floor": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             mathFunc(math.Floor),
+	},
+	"sqrt": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             mathFunc(math.Sqrt),
+	},
+	"exp": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             mathFunc(math.Exp),
+	},
+	"log10": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             mathFunc(math.Log10),
+	},
+	"log2": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             mathFunc(math.Log2),
+	},
+	"sign": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             mathFunc(sign),
+	},
+	"sin": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             mathFunc(math.Sin),
+	},
+	"cos": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             mathFunc(math.Cos),
+	},
+	"tan": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             mathFunc(math.Tan),
+	},
+	"asin": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             mathFunc(math.Asin),
+	},
+	"acos": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             mathFunc(math.Acos),
+	},
+	"atan": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet},
+		VariantReturn: true,
+		F:             mathFunc(math.Atan),
+	},
+	"round": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeScalar},
+		VariantReturn: true,
+		F:             round,
+	},
+	"pow": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeScalar},
+		VariantReturn: true,
+		F:             pow,
+	},
+	"clamp": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeScalar, parse.TypeScalar},
+		VariantReturn: true,
+		F:             clamp,
+	},
+	"clamp_min": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeScalar},
+		VariantReturn: true,
+		F:             clampMin,
+	},
+	"clamp_max": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeScalar},
+		VariantReturn: true,
+		F:             clampMax,
+	},
 	"nan": {
 		Return: parse.TypeScalar,
 		F:      nan,
@@ -29,26 +121,314 @@ var builtins = map[string]parse.Func{
 		Return: parse.TypeScalar,
 		F:      null,
 	},
+	"for": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeString},
+		Return: parse.TypeSeriesSet,
+		F:      forWindow,
+	},
+	"rate": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet},
+		Return: parse.TypeSeriesSet,
+		F:      rate,
+	},
+	"increase": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet},
+		Return: parse.TypeSeriesSet,
+		F:      increase,
+	},
+	"delta": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet},
+		Return: parse.TypeSeriesSet,
+		F:      delta,
+	},
+	"deriv": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet},
+		Return: parse.TypeSeriesSet,
+		F:      deriv,
+	},
+	"moving_avg": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeString},
+		Return: parse.TypeSeriesSet,
+		F:      movingAvg,
+	},
+	"moving_sum": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeString},
+		Return: parse.TypeSeriesSet,
+		F:      movingSum,
+	},
+	"moving_min": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeString},
+		Return: parse.TypeSeriesSet,
+		F:      movingMin,
+	},
+	"moving_max": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeString},
+		Return: parse.TypeSeriesSet,
+		F:      movingMax,
+	},
+	"moving_median": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeString},
+		Return: parse.TypeSeriesSet,
+		F:      movingMedian,
+	},
+	"ewma": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeScalar},
+		Return: parse.TypeSeriesSet,
+		F:      ewma,
+	},
+	"cumsum": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet},
+		Return: parse.TypeSeriesSet,
+		F:      cumsum,
+	},
+	"timeshift": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeString},
+		Return: parse.TypeSeriesSet,
+		F:      timeShift,
+	},
+	"absent": {
+		Args:   []parse.ReturnType{parse.TypeVariantSet},
+		Return: parse.TypeNumberSet,
+		F:      absent,
+	},
+	"count_series": {
+		Args:   []parse.ReturnType{parse.TypeVariantSet},
+		Return: parse.TypeNumberSet,
+		F:      countSeries,
+	},
+	"time": {
+		Return: parse.TypeScalar,
+		F:      timeNow,
+	},
+	"age": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet},
+		Return: parse.TypeNumberSet,
+		F:      age,
+	},
+	"timestamp": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet},
+		Return: parse.TypeSeriesSet,
+		F:      timestamp,
+	},
+	"hour": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet},
+		Return: parse.TypeSeriesSet,
+		F:      hour,
+	},
+	"day_of_week": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet},
+		Return: parse.TypeSeriesSet,
+		F:      dayOfWeek,
+	},
+	"day_of_month": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet},
+		Return: parse.TypeSeriesSet,
+		F:      dayOfMonth,
+	},
+	"business_hours": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet},
+		Return: parse.TypeSeriesSet,
+		F:      businessHours,
+	},
+	"time_mask": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeString, parse.TypeString},
+		Return: parse.TypeSeriesSet,
+		F:      timeMask,
+	},
+	"predict_linear": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeString},
+		Return: parse.TypeSeriesSet,
+		F:      predictLinear,
+	},
+	"holt_winters": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeScalar, parse.TypeScalar},
+		Return: parse.TypeSeriesSet,
+		F:      holtWinters,
+	},
+	"holt_winters_forecast": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeScalar, parse.TypeScalar, parse.TypeString},
+		Return: parse.TypeSeriesSet,
+		F:      holtWintersForecast,
+	},
+	"zscore": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeString},
+		Return: parse.TypeSeriesSet,
+		F:      zscore,
+	},
+	"mad_outliers": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeScalar},
+		Return: parse.TypeSeriesSet,
+		F:      madOutliers,
+	},
+	"seasonal_baseline": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeString, parse.TypeScalar},
+		Return: parse.TypeSeriesSet,
+		F:      seasonalBaseline,
+	},
+	"seasonal_deviation": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeString, parse.TypeScalar},
+		Return: parse.TypeSeriesSet,
+		F:      seasonalDeviation,
+	},
+	"topk": {
+		Args:          []parse.ReturnType{parse.TypeScalar, parse.TypeVariantSet, parse.TypeString},
+		VariantReturn: true,
+		F:             topk,
+	},
+	"bottomk": {
+		Args:          []parse.ReturnType{parse.TypeScalar, parse.TypeVariantSet, parse.TypeString},
+		VariantReturn: true,
+		F:             bottomk,
+	},
+	"topk_other": {
+		Args:          []parse.ReturnType{parse.TypeScalar, parse.TypeVariantSet, parse.TypeString, parse.TypeString},
+		VariantReturn: true,
+		F:             topkOther,
+	},
+	"bottomk_other": {
+		Args:          []parse.ReturnType{parse.TypeScalar, parse.TypeVariantSet, parse.TypeString, parse.TypeString},
+		VariantReturn: true,
+		F:             bottomkOther,
+	},
+	"fill": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet, parse.TypeScalar},
+		Return: parse.TypeSeriesSet,
+		F:      fill,
+	},
+	"fill_previous": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet},
+		Return: parse.TypeSeriesSet,
+		F:      fillPrevious,
+	},
+	"fill_linear": {
+		Args:   []parse.ReturnType{parse.TypeSeriesSet},
+		Return: parse.TypeSeriesSet,
+		F:      fillLinear,
+	},
+	"filter": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeString},
+		VariantReturn: true,
+		F:             filter,
+	},
+	"aggregate": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeString, parse.TypeString},
+		VariantReturn: true,
+		F:             aggregate,
+	},
+	"label_set": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeString, parse.TypeString},
+		VariantReturn: true,
+		F:             labelSet,
+	},
+	"label_drop": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeString},
+		VariantReturn: true,
+		F:             labelDrop,
+	},
+	"label_keep": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeString},
+		VariantReturn: true,
+		F:             labelKeep,
+	},
+	"label_rename": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeString, parse.TypeString},
+		VariantReturn: true,
+		F:             labelRename,
+	},
+	"label_replace": {
+		Args:          []parse.ReturnType{parse.TypeVariantSet, parse.TypeString, parse.TypeString, parse.TypeString, parse.TypeString},
+		VariantReturn: true,
+		F:             labelReplace,
+	},
 }
 
 // abs returns the absolute value for each result in NumberSet, SeriesSet, or Scalar
 func abs(e *State, varSet Results) Results {
-	newRes := Results{}
-	for _, res := range varSet.Values {
-		newVal := perFloat(res, math.Abs)
-		newRes.Values = append(newRes.Values, newVal)
-	}
-	return newRes
+	return mathFunc(math.Abs)(e, varSet)
 }
 
 // log returns the natural logarithm value for each result in NumberSet, SeriesSet, or Scalar
 func log(e *State, varSet Results) Results {
-	newRes := Results{}
-	for _, res := range varSet.Values {
-		newVal := perFloat(res, math.Log)
-		newRes.Values = append(newRes.Values, newVal)
+	return mathFunc(math.Log)(e, varSet)
+}
+
+// mathFunc returns a function that applies floatF to each result in NumberSet, SeriesSet, or Scalar
+func mathFunc(floatF func(x float64) float64) func(e *State, varSet Results) Results {
+	return func(e *State, varSet Results) Results {
+		newRes := Results{}
+		for _, res := range varSet.Values {
+			newVal := perFloat(res, floatF, e.NullMode)
+			newRes.Values = append(newRes.Values, newVal)
+		}
+		return newRes
+	}
+}
+
+// sign returns -1 for negative numbers, 1 for positive numbers, and x for 0 and NaN.
+func sign(x float64) float64 {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
 	}
-	return newRes
+	return x
+}
+
+// round rounds each result in NumberSet, SeriesSet, or Scalar to precision decimal places.
+// A negative precision rounds to tens, hundreds, etc. Halves are rounded away from zero.
+func round(e *State, varSet Results, precision float64) Results {
+	precision = math.Trunc(precision)
+	if precision < 0 {
+		p := math.Pow(10, -precision)
+		return mathFunc(func(x float64) float64 {
+			return math.Round(x/p) * p
+		})(e, varSet)
+	}
+	p := math.Pow(10, precision)
+	return mathFunc(func(x float64) float64 {
+		return math.Round(x*p) / p
+	})(e, varSet)
+}
+
+// pow raises each result in NumberSet, SeriesSet, or Scalar to the power of exponent.
+func pow(e *State, varSet Results, exponent float64) Results {
+	return mathFunc(func(x float64) float64 {
+		return math.Pow(x, exponent)
+	})(e, varSet)
+}
+
+// clamp limits each result in NumberSet, SeriesSet, or Scalar to be between min and max.
+func clamp(e *State, varSet Results, min, max float64) (Results, error) {
+	if min > max {
+		return Results{}, fmt.Errorf("clamp min %v is greater than max %v", min, max)
+	}
+	return mathFunc(func(x float64) float64 {
+		if math.IsNaN(x) {
+			return x
+		}
+		return math.Max(min, math.Min(max, x))
+	})(e, varSet), nil
+}
+
+// clampMin limits each result in NumberSet, SeriesSet, or Scalar to be at least min.
+func clampMin(e *State, varSet Results, min float64) Results {
+	return mathFunc(func(x float64) float64 {
+		if math.IsNaN(x) {
+			return x
+		}
+		return math.Max(min, x)
+	})(e, varSet)
+}
+
+// clampMax limits each result in NumberSet, SeriesSet, or Scalar to be at most max.
+func clampMax(e *State, varSet Results, max float64) Results {
+	return mathFunc(func(x float64) float64 {
+		if math.IsNaN(x) {
+			return x
+		}
+		return math.Min(max, x)
+	})(e, varSet)
 }
 
 // nan returns a scalar nan value
@@ -68,35 +448,485 @@ func null(e *State) Results {
 	return NewScalarResults(nil)
 }
 
-func perFloat(val Value, floatF func(x float64) float64) Value {
+// forWindow returns, for each series in SeriesSet, a series that is 1 where the
+// series has been true (non-zero) for the window and 0 otherwise.
+// The window is a duration (e.g. "10m") or a number of points (e.g. "5").
+func forWindow(e *State, varSet Results, window string) (Results, error) {
+	newRes := Results{}
+	w, err := ParseWindow(window)
+	if err != nil {
+		return newRes, err
+	}
+	return perSeries("for", varSet, func(s Series) Series { return s.For(w) })
+}
+
+// rate returns the per-second rate of increase of each counter in SeriesSet,
+// correcting for counter resets.
+func rate(e *State, varSet Results) (Results, error) {
+	return perSeries("rate", varSet, e.NullMode.seriesFunc(Series.Rate))
+}
+
+// increase returns the increase between points of each counter in SeriesSet,
+// correcting for counter resets.
+func increase(e *State, varSet Results) (Results, error) {
+	return perSeries("increase", varSet, e.NullMode.seriesFunc(Series.Increase))
+}
+
+// delta returns the difference between points of each series in SeriesSet.
+func delta(e *State, varSet Results) (Results, error) {
+	return perSeries("delta", varSet, e.NullMode.seriesFunc(Series.Delta))
+}
+
+// deriv returns the per-second derivative between points of each series in SeriesSet.
+func deriv(e *State, varSet Results) (Results, error) {
+	return perSeries("deriv", varSet, e.NullMode.seriesFunc(Series.Deriv))
+}
+
+// movingAvg returns the moving average of each series in SeriesSet over the window,
+// which is a number of points (e.g. "5") or a duration (e.g. "10m").
+func movingAvg(e *State, varSet Results, window string) (Results, error) {
+	return movingWindow("moving_avg", e, varSet, window, Aggregator{Name: "mean"})
+}
+
+// movingSum returns the moving sum of each series in SeriesSet over the window.
+func movingSum(e *State, varSet Results, window string) (Results, error) {
+	return movingWindow("moving_sum", e, varSet, window, Aggregator{Name: "sum"})
+}
+
+// movingMin returns the moving minimum of each series in SeriesSet over the window.
+func movingMin(e *State, varSet Results, window string) (Results, error) {
+	return movingWindow("moving_min", e, varSet, window, Aggregator{Name: "min"})
+}
+
+// movingMax returns the moving maximum of each series in SeriesSet over the window.
+func movingMax(e *State, varSet Results, window string) (Results, error) {
+	return movingWindow("moving_max", e, varSet, window, Aggregator{Name: "max"})
+}
+
+// movingMedian returns the moving median of each series in SeriesSet over the window.
+func movingMedian(e *State, varSet Results, window string) (Results, error) {
+	return movingWindow("moving_median", e, varSet, window, Aggregator{Name: "quantile", Param: 0.5})
+}
+
+func movingWindow(name string, e *State, varSet Results, window string, agg Aggregator) (Results, error) {
+	w, err := ParseWindow(window)
+	if err != nil {
+		return Results{}, err
+	}
+	return perSeries(name, varSet, e.NullMode.seriesFunc(func(s Series) Series { return s.MovingWindow(w, agg) }))
+}
+
+// ewma returns the exponentially weighted moving average of each series in SeriesSet
+// with the smoothing factor alpha.
+func ewma(e *State, varSet Results, alpha float64) (Results, error) {
+	if !(alpha > 0 && alpha <= 1) {
+		return Results{}, fmt.Errorf("ewma alpha must be greater than 0 and at most 1, got %v", alpha)
+	}
+	return perSeries("ewma", varSet, e.NullMode.seriesFunc(func(s Series) Series { return s.EWMA(alpha) }))
+}
+
+// cumsum returns the cumulative sum of each series in SeriesSet.
+func cumsum(e *State, varSet Results) (Results, error) {
+	return perSeries("cumsum", varSet, e.NullMode.seriesFunc(Series.CumSum))
+}
+
+// timeShift moves the points of each series in SeriesSet forward in time by the
+// duration (e.g. "1w" or "-1d").
+func timeShift(e *State, varSet Results, duration string) (Results, error) {
+	d, err := ParseDuration(duration)
+	if err != nil {
+		return Results{}, err
+	}
+	return perSeries("timeshift", varSet, func(s Series) Series { return s.TimeShift(d) })
+}
+
+// absent returns a Number that is 1 if varSet has no data, and 0 otherwise.
+// See Results.NoData.
+func absent(e *State, varSet Results) Results {
+	f := 0.0
+	if varSet.NoData() {
+		f = 1
+	}
+	n := NewNumber("", nil)
+	n.SetValue(&f)
+	return Results{[]Value{n}}
+}
+
+// countSeries returns a Number that is the number of values in varSet.
+func countSeries(e *State, varSet Results) Results {
+	f := float64(len(varSet.Values))
+	n := NewNumber("", nil)
+	n.SetValue(&f)
+	return Results{[]Value{n}}
+}
+
+// timeNow returns the current time, or the Now option if it is set, as a scalar
+// of seconds since the Unix epoch.
+func timeNow(e *State) Results {
+	f := unixSeconds(e.now())
+	return NewScalarResults(&f)
+}
+
+// now returns the Now option, or the current time if it is not set.
+func (e *State) now() time.Time {
+	if e.Now.IsZero() {
+		return time.Now()
+	}
+	return e.Now
+}
+
+// age returns, for each series in SeriesSet, a number that is the time in seconds
+// since its last point that is not null or NaN, as of the time function.
+func age(e *State, varSet Results) (Results, error) {
+	newRes := Results{}
+	now := e.now()
+	for _, res := range varSet.Values {
+		series, ok := res.(Series)
+		if !ok {
+			return newRes, fmt.Errorf("age expects a series, got type %v", res.Type())
+		}
+		newRes.Values = append(newRes.Values, series.Age(now))
+	}
+	return newRes, nil
+}
+
+// timestamp returns, for each series in SeriesSet, the time of each point in
+// seconds since the Unix epoch.
+func timestamp(e *State, varSet Results) (Results, error) {
+	return perSeries("timestamp", varSet, func(s Series) Series {
+		return s.mapTimes(e.Location, unixSeconds)
+	})
+}
+
+// hour returns, for each series in SeriesSet, the hour of the day (0-23) of each point.
+func hour(e *State, varSet Results) (Results, error) {
+	return perSeries("hour", varSet, func(s Series) Series {
+		return s.mapTimes(e.Location, func(t time.Time) float64 { return float64(t.Hour()) })
+	})
+}
+
+// dayOfWeek returns, for each series in SeriesSet, the day of the week of each
+// point, where Sunday is 0.
+func dayOfWeek(e *State, varSet Results) (Results, error) {
+	return perSeries("day_of_week", varSet, func(s Series) Series {
+		return s.mapTimes(e.Location, func(t time.Time) float64 { return float64(t.Weekday()) })
+	})
+}
+
+// dayOfMonth returns, for each series in SeriesSet, the day of the month (1-31) of each point.
+func dayOfMonth(e *State, varSet Results) (Results, error) {
+	return perSeries("day_of_month", varSet, func(s Series) Series {
+		return s.mapTimes(e.Location, func(t time.Time) float64 { return float64(t.Day()) })
+	})
+}
+
+// businessHoursMask is Monday to Friday from 09:00 to 17:00.
+var businessHoursMask, _ = ParseTimeMask("Mon-Fri", "09:00-17:00")
+
+// businessHours returns, for each series in SeriesSet, 1 where the point is within
+// business hours, Monday to Friday from 09:00 to 17:00, and 0 otherwise.
+func businessHours(e *State, varSet Results) (Results, error) {
+	return perSeries("business_hours", varSet, func(s Series) Series {
+		return s.TimeMask(businessHoursMask, e.Location)
+	})
+}
+
+// timeMask returns, for each series in SeriesSet, 1 where the point is within the
+// weekly window of the days (e.g. "Sat,Sun") and hours (e.g. "02:00-04:00"), and
+// 0 otherwise. See ParseTimeMask.
+func timeMask(e *State, varSet Results, days, hours string) (Results, error) {
+	m, err := ParseTimeMask(days, hours)
+	if err != nil {
+		return Results{}, err
+	}
+	return perSeries("time_mask", varSet, func(s Series) Series {
+		return s.TimeMask(m, e.Location)
+	})
+}
+
+// predictLinear returns, for each series in SeriesSet, the linear regression of the
+// series, with forecast points up to the horizon (e.g. "4h") after the last point.
+func predictLinear(e *State, varSet Results, horizon string) (Results, error) {
+	h, err := parseHorizon(horizon)
+	if err != nil {
+		return Results{}, err
+	}
+	return perSeriesWithError("predict_linear", varSet, e.NullMode.seriesFuncWithError(func(s Series) (Series, error) { return s.PredictLinear(h) }))
+}
+
+// holtWinters returns, for each series in SeriesSet, the series smoothed with double
+// exponential smoothing with the smoothing factor sf and the trend factor tf.
+func holtWinters(e *State, varSet Results, sf, tf float64) (Results, error) {
+	return holtWintersForecast(e, varSet, sf, tf, "0s")
+}
+
+// holtWintersForecast is like holtWinters, with forecast points up to the horizon
+// (e.g. "4h") after the last point.
+func holtWintersForecast(e *State, varSet Results, sf, tf float64, horizon string) (Results, error) {
+	if !(sf > 0 && sf < 1) || !(tf > 0 && tf < 1) {
+		return Results{}, fmt.Errorf("holt_winters smoothing factors must be greater than 0 and less than 1, got %v and %v", sf, tf)
+	}
+	h, err := parseHorizon(horizon)
+	if err != nil {
+		return Results{}, err
+	}
+	return perSeriesWithError("holt_winters", varSet, e.NullMode.seriesFuncWithError(func(s Series) (Series, error) { return s.HoltWinters(sf, tf, h) }))
+}
+
+// parseHorizon parses the duration of a forecast, which must not be negative.
+func parseHorizon(horizon string) (time.Duration, error) {
+	h, err := ParseDuration(horizon)
+	if err != nil {
+		return 0, err
+	}
+	if h < 0 {
+		return 0, fmt.Errorf("forecast horizon must not be negative, got %v", h)
+	}
+	return h, nil
+}
+
+// zscore returns, for each series in SeriesSet, the z-score of each point against
+// the window before it, which is a number of points (e.g. "10") or a duration (e.g. "1h").
+func zscore(e *State, varSet Results, window string) (Results, error) {
+	w, err := ParseWindow(window)
+	if err != nil {
+		return Results{}, err
+	}
+	return perSeries("zscore", varSet, e.NullMode.seriesFunc(func(s Series) Series { return s.ZScore(w) }))
+}
+
+// madOutliers returns, for each series in SeriesSet, 1 where the point is more than
+// threshold scaled median absolute deviations from the median, and 0 otherwise.
+func madOutliers(e *State, varSet Results, threshold float64) (Results, error) {
+	if !(threshold > 0) {
+		return Results{}, fmt.Errorf("mad_outliers threshold must be greater than 0, got %v", threshold)
+	}
+	return perSeries("mad_outliers", varSet, e.NullMode.seriesFunc(func(s Series) Series { return s.MADOutliers(threshold) }))
+}
+
+// seasonalBaseline returns, for each series in SeriesSet, the mean of the values at
+// the same time in the previous n periods (e.g. "1d" or "1w").
+func seasonalBaseline(e *State, varSet Results, period string, n float64) (Results, error) {
+	p, err := parseSeasons("seasonal_baseline", period, n)
+	if err != nil {
+		return Results{}, err
+	}
+	return perSeries("seasonal_baseline", varSet, e.NullMode.seriesFunc(func(s Series) Series { return s.SeasonalBaseline(p, int(n)) }))
+}
+
+// seasonalDeviation returns, for each series in SeriesSet, each value minus the mean
+// of the values at the same time in the previous n periods (e.g. "1d" or "1w").
+func seasonalDeviation(e *State, varSet Results, period string, n float64) (Results, error) {
+	p, err := parseSeasons("seasonal_deviation", period, n)
+	if err != nil {
+		return Results{}, err
+	}
+	return perSeries("seasonal_deviation", varSet, e.NullMode.seriesFunc(func(s Series) Series { return s.SeasonalDeviation(p, int(n)) }))
+}
+
+// parseSeasons parses the period of a seasonal function, which must be positive, and
+// checks that the number of periods n is a positive integer.
+func parseSeasons(name, period string, n float64) (time.Duration, error) {
+	p, err := ParseDuration(period)
+	if err != nil {
+		return 0, err
+	}
+	if p <= 0 {
+		return 0, fmt.Errorf("%v period must be positive, got %v", name, p)
+	}
+	if n < 1 || n != math.Trunc(n) {
+		return 0, fmt.Errorf("%v number of periods must be a positive integer, got %v", name, n)
+	}
+	return p, nil
+}
+
+// topk returns the k series in varSet with the greatest reduction by the reducer
+// (e.g. "mean"), or the k numbers with the greatest value. See Results.TopK.
+func topk(e *State, k float64, varSet Results, reducer string) (Results, error) {
+	return selectK("topk", e, k, varSet, reducer, false)
+}
+
+// bottomk returns the k series in varSet with the least reduction by the reducer,
+// or the k numbers with the least value. See Results.TopK.
+func bottomk(e *State, k float64, varSet Results, reducer string) (Results, error) {
+	return selectK("bottomk", e, k, varSet, reducer, true)
+}
+
+// topkOther is like topk, with one more value labelled __other__ that aggregates
+// the values that are not selected with the aggregator (e.g. "sum").
+func topkOther(e *State, k float64, varSet Results, reducer, aggregator string) (Results, error) {
+	return selectKOther("topk_other", e, k, varSet, reducer, aggregator, false)
+}
+
+// bottomkOther is like bottomk, with one more value labelled __other__ that aggregates
+// the values that are not selected with the aggregator (e.g. "sum").
+func bottomkOther(e *State, k float64, varSet Results, reducer, aggregator string) (Results, error) {
+	return selectKOther("bottomk_other", e, k, varSet, reducer, aggregator, true)
+}
+
+func selectK(name string, e *State, k float64, varSet Results, reducer string, bottom bool) (Results, error) {
+	selected, _, err := topK(name, e, k, varSet, reducer, bottom)
+	return selected, err
+}
+
+func selectKOther(name string, e *State, k float64, varSet Results, reducer, aggregator string, bottom bool) (Results, error) {
+	agg, err := ParseAggregator(aggregator)
+	if err != nil {
+		return Results{}, err
+	}
+	selected, rest, err := topK(name, e, k, varSet, reducer, bottom)
+	if err != nil || len(rest.Values) == 0 {
+		return selected, err
+	}
+	other, err := rest.Other(agg, e.NullMode)
+	if err != nil {
+		return selected, err
+	}
+	selected.Values = append(selected.Values, other.Values...)
+	return selected, nil
+}
+
+// topK checks that k is a non-negative integer and calls Results.TopK. k is limited
+// to the number of values, so a huge k does not overflow an int.
+func topK(name string, e *State, k float64, varSet Results, reducer string, bottom bool) (selected, rest Results, err error) {
+	if k < 0 || k != math.Trunc(k) {
+		return selected, rest, fmt.Errorf("%v k must be a non-negative integer, got %v", name, k)
+	}
+	if n := float64(len(varSet.Values)); k > n {
+		k = n
+	}
+	return varSet.TopK(int(k), reducer, bottom, e.NullMode)
+}
+
+// fill replaces the null and NaN values of each series in SeriesSet with v. Like the
+// other fill functions, it is not affected by the NullMode.
+func fill(e *State, varSet Results, v float64) (Results, error) {
+	return perSeries("fill", varSet, func(s Series) Series { return s.Fill(v) })
+}
+
+// fillPrevious replaces the null and NaN values of each series in SeriesSet with
+// the previous value.
+func fillPrevious(e *State, varSet Results) (Results, error) {
+	return perSeries("fill_previous", varSet, Series.FillPrevious)
+}
+
+// fillLinear replaces the null and NaN values of each series in SeriesSet with
+// values interpolated between the values either side.
+func fillLinear(e *State, varSet Results) (Results, error) {
+	return perSeries("fill_linear", varSet, Series.FillLinear)
+}
+
+// perSeries applies seriesF to each series in varSet. name is the name of
+// the function for errors.
+func perSeries(name string, varSet Results, seriesF func(s Series) Series) (Results, error) {
+	newRes := Results{}
+	for _, res := range varSet.Values {
+		series, ok := res.(Series)
+		if !ok {
+			return newRes, fmt.Errorf("%v expects a series, got type %v", name, res.Type())
+		}
+		newRes.Values = append(newRes.Values, seriesF(series))
+	}
+	return newRes, nil
+}
+
+// perSeriesWithError is like perSeries for a seriesF that can fail.
+func perSeriesWithError(name string, varSet Results, seriesF func(s Series) (Series, error)) (Results, error) {
+	newRes := Results{}
+	for _, res := range varSet.Values {
+		series, ok := res.(Series)
+		if !ok {
+			return newRes, fmt.Errorf("%v expects a series, got type %v", name, res.Type())
+		}
+		newSeries, err := seriesF(series)
+		if err != nil {
+			return newRes, err
+		}
+		newRes.Values = append(newRes.Values, newSeries)
+	}
+	return newRes, nil
+}
+
+// filter returns the results in NumberSet or SeriesSet whose labels match
+// the Prometheus style label matchers, e.g. `host=~"web-.*", env!="staging"`.
+func filter(e *State, varSet Results, matchers string) (Results, error) {
+	ms, err := ParseMatchers(matchers)
+	if err != nil {
+		return Results{}, err
+	}
+	return varSet.Filter(ms), nil
+}
+
+// aggregate aggregates across the NumberSet or SeriesSet by the grouping labels,
+// e.g. aggregate($A, "sum", "by(host)") or aggregate($A, "quantile(0.9)", "without(instance)").
+func aggregate(e *State, varSet Results, aggregator, grouping string) (Results, error) {
+	agg, err := ParseAggregator(aggregator)
+	if err != nil {
+		return Results{}, err
+	}
+	g, err := ParseGrouping(grouping)
+	if err != nil {
+		return Results{}, err
+	}
+	return varSet.AggregateWithNullMode(agg, g, e.NullMode)
+}
+
+// labelSet sets the label name to value on each result in NumberSet or SeriesSet.
+// An empty value removes the label.
+func labelSet(e *State, varSet Results, name, value string) (Results, error) {
+	return varSet.SetLabel(name, value)
+}
+
+// labelDrop removes the comma separated labels from each result in NumberSet or SeriesSet.
+func labelDrop(e *State, varSet Results, names string) (Results, error) {
+	labelNames, err := splitLabelNames(names)
+	if err != nil {
+		return Results{}, err
+	}
+	return varSet.DropLabels(labelNames...), nil
+}
+
+// labelKeep removes all but the comma separated labels from each result in NumberSet or SeriesSet.
+func labelKeep(e *State, varSet Results, names string) (Results, error) {
+	labelNames, err := splitLabelNames(names)
+	if err != nil {
+		return Results{}, err
+	}
+	return varSet.KeepLabels(labelNames...), nil
+}
+
+// labelRename renames the label oldName to newName on each result in NumberSet or SeriesSet.
+func labelRename(e *State, varSet Results, oldName, newName string) (Results, error) {
+	return varSet.RenameLabel(oldName, newName)
+}
+
+// labelReplace is like Prometheus's label_replace(v, dst, replacement, src, regex).
+func labelReplace(e *State, varSet Results, dst, replacement, src, regex string) (Results, error) {
+	return varSet.ReplaceLabel(dst, replacement, src, regex)
+}
+
+// perFloat applies floatF to each float in val. Nulls are handled according to nullMode.
+func perFloat(val Value, floatF func(x float64) float64, nullMode NullMode) Value {
 	var newVal Value
 	switch val.Type() {
 	case parse.TypeNumberSet:
 		n := NewNumber(val.GetName(), val.GetLabels())
-		f := val.(Number).GetFloat64Value()
-		nF := math.NaN()
-		if f != nil {
-			nF = floatF(*f)
-		}
-		n.SetValue(&nF)
+		nF, _ := nullMode.floatOp(val.(Number).GetFloat64Value(), floatF)
+		n.SetValue(nF)
 		newVal = n
 	case parse.TypeScalar:
-		f := val.(Scalar).GetFloat64Value()
-		nF := math.NaN()
-		if f != nil {
-			nF = floatF(*f)
-		}
-		newVal = NewScalar(&nF)
+		nF, _ := nullMode.floatOp(val.(Scalar).GetFloat64Value(), floatF)
+		newVal = NewScalar(nF)
 	case parse.TypeSeriesSet:
 		resSeries := val.(Series)
-		newSeries := NewSeries(resSeries.GetName(), resSeries.GetLabels(), resSeries.TimeIdx, resSeries.TimeIsNullable, resSeries.ValueIdx, resSeries.ValueIsNullabe, resSeries.Len())
+		newSeries := NewSeries(resSeries.GetName(), resSeries.GetLabels(), resSeries.TimeIdx, resSeries.TimeIsNullable, resSeries.ValueIdx, resSeries.ValueIsNullabe, 0)
 		for i := 0; i < resSeries.Len(); i++ {
 			t, f := resSeries.GetPoint(i)
-			nF := math.NaN()
-			if f != nil {
-				nF = floatF(*f)
+			nF, skip := nullMode.floatOp(f, floatF)
+			if skip {
+				continue
 			}
-			newSeries.SetPoint(i, t, &nF)
+			newSeries.AppendPoint(i, t, nF)
 		}
 		newVal = newSeries
 	}
@@ -1,8 +1,10 @@
 package mathexp
 
 import (
+	"math"
 	"testing"
 
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -86,3 +88,106 @@ func TestFunc(t *testing.T) {
 		})
 	}
 }
+
+func TestMathFuncs(t *testing.T) {
+	var tests = []struct {
+		expr   string
+		result float64
+	}{
+		{"abs(1)", 1},
+		{"round(3.14159, 2)", 3.14},
+		{"round(1250, -2)", 1300},
+		{"round(-2.5, 0)", -3},
+		{"ceil(1.2)", 2},
+		{"floor(-1.2)", -2},
+		{"sqrt(16)", 4},
+		{"exp(0)", 1},
+		{"log10(1000)", 3},
+		{"log2(8)", 3},
+		{"pow(2, 10)", 1024},
+		{"pow(4, 0.5)", 2},
+		{"sign(-3)", -1},
+		{"sign(0)", 0},
+		{"clamp(5, -1, 1)", 1},
+		{"clamp(-5, -1, 1)", -1},
+		{"clamp(0.5, -1, 1)", 0.5},
+		{"clamp_min(-5, 0)", 0},
+		{"clamp_max(5, 2)", 2},
+		{"sin(0)", 0},
+		{"cos(0)", 1},
+		{"tan(0)", 0},
+		{"asin(1)", math.Pi / 2},
+		{"acos(1)", 0},
+		{"atan(1)", math.Pi / 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := New(tt.expr)
+			assert.NoError(t, err)
+			res, err := e.Execute(Vars{})
+			assert.NoError(t, err)
+			assert.Equal(t, Results{[]Value{NewScalar(&tt.result)}}, res)
+		})
+	}
+}
+
+func TestMathFuncsKeepTypes(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "a"}, float64Pointer(2.345)),
+			},
+		},
+		"B": Results{
+			[]Value{
+				makeSeriesNullableTime("", nil, nullTimeTP{
+					unixTimePointer(5, 0), float64Pointer(-2),
+				}, nullTimeTP{
+					unixTimePointer(10, 0), float64Pointer(3),
+				}),
+			},
+		},
+	}
+	var tests = []struct {
+		name      string
+		expr      string
+		execErrIs assert.ErrorAssertionFunc
+		results   Results
+	}{
+		{
+			name:      "round number",
+			expr:      "round($A, 1)",
+			execErrIs: assert.NoError,
+			results:   Results{[]Value{makeNumber("", data.Labels{"host": "a"}, float64Pointer(2.3))}},
+		},
+		{
+			name:      "clamp series",
+			expr:      "clamp($B, -1, 1)",
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeSeriesNullableTime("", nil, nullTimeTP{
+						unixTimePointer(5, 0), float64Pointer(-1),
+					}, nullTimeTP{
+						unixTimePointer(10, 0), float64Pointer(1),
+					}),
+				},
+			},
+		},
+		{
+			name:      "clamp with min greater than max errors",
+			expr:      "clamp($B, 1, -1)",
+			execErrIs: assert.Error,
+			results:   Results{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			assert.NoError(t, err)
+			res, err := e.Execute(vars)
+			tt.execErrIs(t, err)
+			assert.Equal(t, tt.results, res)
+		})
+	}
+}
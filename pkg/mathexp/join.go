@@ -0,0 +1,196 @@
+package mathexp
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// JoinMode is how the points of two series are joined by time in binary operations.
+type JoinMode int
+
+const (
+	// JoinInner only joins points where both series have a point with the same time.
+	JoinInner JoinMode = iota
+	// JoinOuter joins on the times of both series. A missing point is null.
+	JoinOuter
+	// JoinPrevious joins on the times of both series. A missing point is filled with
+	// the previous value of that series, or null if there is no previous point.
+	JoinPrevious
+	// JoinLinear joins on the times of both series. A missing point is linearly
+	// interpolated from the points of that series either side of the time, or null if
+	// the time is outside of the series.
+	JoinLinear
+	// JoinNearest joins each point of the first series with the nearest point in time
+	// of the second series that is within the join tolerance.
+	JoinNearest
+)
+
+// ParseJoinMode returns a JoinMode from its string representation.
+// An empty string is the default of JoinInner.
+func ParseJoinMode(s string) (JoinMode, error) {
+	switch s {
+	case "", "inner":
+		return JoinInner, nil
+	case "outer":
+		return JoinOuter, nil
+	case "previous":
+		return JoinPrevious, nil
+	case "linear":
+		return JoinLinear, nil
+	case "nearest":
+		return JoinNearest, nil
+	default:
+		return JoinInner, fmt.Errorf("join mode %v not implemented", s)
+	}
+}
+
+func (j JoinMode) String() string {
+	switch j {
+	case JoinInner:
+		return "inner"
+	case JoinOuter:
+		return "outer"
+	case JoinPrevious:
+		return "previous"
+	case JoinLinear:
+		return "linear"
+	case JoinNearest:
+		return "nearest"
+	default:
+		return "unknown"
+	}
+}
+
+// point is a single time and value of a Series.
+type point struct {
+	t time.Time
+	f *float64
+}
+
+// sortedPoints returns the points of s that have a time, sorted by time.
+func sortedPoints(s Series) []point {
+	points := make([]point, 0, s.Len())
+	for i := 0; i < s.Len(); i++ {
+		t, f := s.GetPoint(i)
+		if t == nil {
+			continue
+		}
+		points = append(points, point{*t, f})
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].t.Before(points[j].t) })
+	return points
+}
+
+// unionTimes returns the sorted distinct times of a and b, which must be sorted.
+func unionTimes(a, b []point) []time.Time {
+	times := make([]time.Time, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var t time.Time
+		switch {
+		case j == len(b) || (i < len(a) && a[i].t.Before(b[j].t)):
+			t = a[i].t
+			i++
+		case i == len(a) || b[j].t.Before(a[i].t):
+			t = b[j].t
+			j++
+		default:
+			t = a[i].t
+			i++
+			j++
+		}
+		if len(times) == 0 || !times[len(times)-1].Equal(t) {
+			times = append(times, t)
+		}
+	}
+	return times
+}
+
+// valueAt returns the value of the sorted points at time t for the join mode.
+func valueAt(points []point, t time.Time, mode JoinMode) *float64 {
+	// idx is the first point at or after t.
+	idx := sort.Search(len(points), func(i int) bool { return !points[i].t.Before(t) })
+	if idx < len(points) && points[idx].t.Equal(t) {
+		return points[idx].f
+	}
+	switch mode {
+	case JoinPrevious:
+		if idx > 0 {
+			return points[idx-1].f
+		}
+	case JoinLinear:
+		if idx > 0 && idx < len(points) {
+			prev, next := points[idx-1], points[idx]
+			if prev.f == nil || next.f == nil {
+				return nil
+			}
+			ratio := float64(t.Sub(prev.t)) / float64(next.t.Sub(prev.t))
+			f := *prev.f + ratio*(*next.f-*prev.f)
+			return &f
+		}
+	}
+	return nil
+}
+
+// nearestValue returns the value of the sorted point nearest to t that is within
+// the tolerance. ok is false if there is no such point.
+func nearestValue(points []point, t time.Time, tolerance time.Duration) (f *float64, ok bool) {
+	idx := sort.Search(len(points), func(i int) bool { return !points[i].t.Before(t) })
+	best := -1
+	var bestDiff time.Duration
+	for _, i := range []int{idx - 1, idx} {
+		if i < 0 || i >= len(points) {
+			continue
+		}
+		diff := points[i].t.Sub(t)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff <= tolerance && (best == -1 || diff < bestDiff) {
+			best, bestDiff = i, diff
+		}
+	}
+	if best == -1 {
+		return nil, false
+	}
+	return points[best].f, true
+}
+
+// biSeriesSeriesJoin performs the binary operation on two series whose points are
+// joined with a JoinMode other than JoinInner. The resulting series is sorted by
+// time and has nullable values.
+func biSeriesSeriesJoin(name string, labels data.Labels, op string, aSeries, bSeries Series, opts Options) (Series, error) {
+	aPoints, bPoints := sortedPoints(aSeries), sortedPoints(bSeries)
+	newSeries := NewSeries(name, labels, aSeries.TimeIdx, aSeries.TimeIsNullable || bSeries.TimeIsNullable, aSeries.ValueIdx, true, 0)
+
+	appendOp := func(idx int, t time.Time, aF, bF *float64) error {
+		nF, skip, err := opts.NullMode.binaryOp(op, aF, bF)
+		if err != nil || skip {
+			return err
+		}
+		return newSeries.AppendPoint(idx, &t, nF)
+	}
+
+	if opts.Join == JoinNearest {
+		for i, p := range aPoints {
+			bF, ok := nearestValue(bPoints, p.t, opts.JoinTolerance)
+			if !ok {
+				continue
+			}
+			if err := appendOp(i, p.t, p.f, bF); err != nil {
+				return newSeries, err
+			}
+		}
+		return newSeries, nil
+	}
+
+	for i, t := range unionTimes(aPoints, bPoints) {
+		if err := appendOp(i, t, valueAt(aPoints, t, opts.Join), valueAt(bPoints, t, opts.Join)); err != nil {
+			return newSeries, err
+		}
+	}
+	return newSeries, nil
+}
@@ -0,0 +1,158 @@
+package mathexp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJoinMode(t *testing.T) {
+	for _, s := range []string{"inner", "outer", "previous", "linear", "nearest"} {
+		j, err := ParseJoinMode(s)
+		assert.NoError(t, err)
+		assert.Equal(t, s, j.String())
+	}
+	j, err := ParseJoinMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, JoinInner, j)
+	_, err = ParseJoinMode("foo")
+	assert.Error(t, err)
+}
+
+func TestSeriesJoin(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeSeries("", nil, tp{
+					time.Unix(0, 0), float64Pointer(1),
+				}, tp{
+					time.Unix(10, 0), float64Pointer(2),
+				}, tp{
+					time.Unix(20, 0), float64Pointer(3),
+				}),
+			},
+		},
+		"B": Results{
+			[]Value{
+				makeSeries("", nil, tp{
+					time.Unix(5, 0), float64Pointer(10),
+				}, tp{
+					time.Unix(10, 0), float64Pointer(20),
+				}, tp{
+					time.Unix(21, 0), float64Pointer(30),
+				}),
+			},
+		},
+	}
+	var tests = []struct {
+		name    string
+		opts    Options
+		results Results
+	}{
+		{
+			name: "inner only joins equal times",
+			opts: Options{Join: JoinInner},
+			results: Results{
+				[]Value{
+					makeSeries("", nil, tp{
+						time.Unix(10, 0), float64Pointer(22),
+					}),
+				},
+			},
+		},
+		{
+			name: "outer fills missing points with null",
+			opts: Options{Join: JoinOuter},
+			results: Results{
+				[]Value{
+					makeSeries("", nil, tp{
+						time.Unix(0, 0), nil,
+					}, tp{
+						time.Unix(5, 0), nil,
+					}, tp{
+						time.Unix(10, 0), float64Pointer(22),
+					}, tp{
+						time.Unix(20, 0), nil,
+					}, tp{
+						time.Unix(21, 0), nil,
+					}),
+				},
+			},
+		},
+		{
+			name: "previous fills missing points with the previous value",
+			opts: Options{Join: JoinPrevious},
+			results: Results{
+				[]Value{
+					makeSeries("", nil, tp{
+						time.Unix(0, 0), nil,
+					}, tp{
+						time.Unix(5, 0), float64Pointer(11),
+					}, tp{
+						time.Unix(10, 0), float64Pointer(22),
+					}, tp{
+						time.Unix(20, 0), float64Pointer(23),
+					}, tp{
+						time.Unix(21, 0), float64Pointer(33),
+					}),
+				},
+			},
+		},
+		{
+			name: "linear interpolates missing points inside the series",
+			opts: Options{Join: JoinLinear},
+			results: Results{
+				[]Value{
+					makeSeries("", nil, tp{
+						time.Unix(0, 0), nil,
+					}, tp{
+						time.Unix(5, 0), float64Pointer(11.5),
+					}, tp{
+						time.Unix(10, 0), float64Pointer(22),
+					}, tp{
+						time.Unix(20, 0), float64Pointer(23 + 100.0/11),
+					}, tp{
+						time.Unix(21, 0), nil,
+					}),
+				},
+			},
+		},
+		{
+			name: "nearest joins on the times of A within the tolerance",
+			opts: Options{Join: JoinNearest, JoinTolerance: time.Second},
+			results: Results{
+				[]Value{
+					makeSeries("", nil, tp{
+						time.Unix(10, 0), float64Pointer(22),
+					}, tp{
+						time.Unix(20, 0), float64Pointer(33),
+					}),
+				},
+			},
+		},
+	}
+	opt := cmp.Comparer(func(x, y float64) bool {
+		return x == y || (x-y < 1e-9 && y-x < 1e-9)
+	})
+	options := append([]cmp.Option{opt}, data.FrameTestCompareOptions()...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New("$A + $B")
+			assert.NoError(t, err)
+			res, err := e.ExecuteWithOptions(vars, tt.opts)
+			assert.NoError(t, err)
+			if diff := cmp.Diff(tt.results, res, options...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestUnionTimes(t *testing.T) {
+	a := []point{{t: time.Unix(1, 0)}, {t: time.Unix(3, 0)}, {t: time.Unix(3, 0)}}
+	b := []point{{t: time.Unix(0, 0)}, {t: time.Unix(3, 0)}, {t: time.Unix(4, 0)}}
+	assert.Equal(t, []time.Time{time.Unix(0, 0), time.Unix(1, 0), time.Unix(3, 0), time.Unix(4, 0)}, unionTimes(a, b))
+}
@@ -0,0 +1,151 @@
+package mathexp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func validateLabelName(name string) error {
+	if !labelNameRe.MatchString(name) {
+		return fmt.Errorf("invalid label name %q", name)
+	}
+	return nil
+}
+
+// splitLabelNames splits a comma separated list of label names.
+func splitLabelNames(s string) ([]string, error) {
+	names := []string{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if err := validateLabelName(name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// copyWithLabels returns a copy of the value with its labels set to labels.
+// The original value is not modified. Scalars have no labels and are returned as is.
+func copyWithLabels(val Value, labels data.Labels) Value {
+	switch v := val.(type) {
+	case Number:
+		n := NewNumber(v.Frame.Fields[0].Name, labels)
+		n.SetValue(v.GetFloat64Value())
+		return n
+	case Series:
+		s := NewSeries(v.Frame.Fields[v.ValueIdx].Name, labels, v.TimeIdx, v.TimeIsNullable, v.ValueIdx, v.ValueIsNullabe, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			t, f := v.GetPoint(i)
+			s.SetPoint(i, t, f)
+		}
+		return s
+	default:
+		return val
+	}
+}
+
+// mapLabels returns new Results where the labels of each value are replaced by
+// the result of labelF on a copy of the value's labels.
+func (r Results) mapLabels(labelF func(l data.Labels) data.Labels) Results {
+	newRes := Results{Values: Values{}}
+	for _, val := range r.Values {
+		l := data.Labels{}
+		for k, v := range val.GetLabels() {
+			l[k] = v
+		}
+		newRes.Values = append(newRes.Values, copyWithLabels(val, labelF(l)))
+	}
+	return newRes
+}
+
+// SetLabel returns a copy of the Results with the label name set to value on each result.
+// If value is empty the label is removed.
+func (r Results) SetLabel(name, value string) (Results, error) {
+	if err := validateLabelName(name); err != nil {
+		return Results{}, err
+	}
+	return r.mapLabels(func(l data.Labels) data.Labels {
+		if value == "" {
+			delete(l, name)
+		} else {
+			l[name] = value
+		}
+		return l
+	}), nil
+}
+
+// DropLabels returns a copy of the Results with the named labels removed from each result.
+func (r Results) DropLabels(names ...string) Results {
+	return r.mapLabels(func(l data.Labels) data.Labels {
+		for _, name := range names {
+			delete(l, name)
+		}
+		return l
+	})
+}
+
+// KeepLabels returns a copy of the Results where each result only has the named labels.
+func (r Results) KeepLabels(names ...string) Results {
+	return r.mapLabels(func(l data.Labels) data.Labels {
+		kept := data.Labels{}
+		for _, name := range names {
+			if v, ok := l[name]; ok {
+				kept[name] = v
+			}
+		}
+		return kept
+	})
+}
+
+// RenameLabel returns a copy of the Results with the label oldName renamed to newName.
+// Results without the label oldName are unchanged.
+func (r Results) RenameLabel(oldName, newName string) (Results, error) {
+	if err := validateLabelName(newName); err != nil {
+		return Results{}, err
+	}
+	return r.mapLabels(func(l data.Labels) data.Labels {
+		if v, ok := l[oldName]; ok {
+			delete(l, oldName)
+			l[newName] = v
+		}
+		return l
+	}), nil
+}
+
+// ReplaceLabel works like Prometheus's label_replace. For each result, if the regular
+// expression regex matches the value of the label src, then the label dst is set to
+// replacement, with $1, $2 etc. replaced by the regex's capture groups. If the
+// expanded replacement is empty the label dst is removed. A missing src label is
+// matched as an empty value. The regular expression is anchored at both ends.
+func (r Results) ReplaceLabel(dst, replacement, src, regex string) (Results, error) {
+	if err := validateLabelName(dst); err != nil {
+		return Results{}, err
+	}
+	re, err := regexp.Compile("^(?:" + regex + ")$")
+	if err != nil {
+		return Results{}, fmt.Errorf("invalid regular expression %q: %w", regex, err)
+	}
+	return r.mapLabels(func(l data.Labels) data.Labels {
+		srcVal := l[src]
+		idx := re.FindStringSubmatchIndex(srcVal)
+		if idx == nil {
+			return l
+		}
+		newVal := string(re.ExpandString(nil, replacement, srcVal, idx))
+		if newVal == "" {
+			delete(l, dst)
+		} else {
+			l[dst] = newVal
+		}
+		return l
+	}), nil
+}
@@ -0,0 +1,164 @@
+package mathexp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelFuncs(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeSeries("cpu", data.Labels{"host": "web-1.us", "env": "prod"}, tp{
+					time.Unix(5, 0), float64Pointer(1),
+				}),
+			},
+		},
+		"B": Results{
+			[]Value{
+				makeNumber("mem", data.Labels{"instance": "db-1.eu"}, float64Pointer(2)),
+			},
+		},
+	}
+	var tests = []struct {
+		name      string
+		expr      string
+		newErrIs  assert.ErrorAssertionFunc
+		execErrIs assert.ErrorAssertionFunc
+		results   Results
+	}{
+		{
+			name:      "label_set adds a label",
+			expr:      `label_set($A, "team", "ops")`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeSeries("cpu", data.Labels{"host": "web-1.us", "env": "prod", "team": "ops"}, tp{
+						time.Unix(5, 0), float64Pointer(1),
+					}),
+				},
+			},
+		},
+		{
+			name:      "label_set with an empty value removes the label",
+			expr:      `label_set($B, "instance", "")`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeNumber("mem", data.Labels{}, float64Pointer(2)),
+				},
+			},
+		},
+		{
+			name:      "label_set with an invalid name",
+			expr:      `label_set($A, "team-name", "ops")`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.Error,
+			results:   Results{},
+		},
+		{
+			name:      "label_drop",
+			expr:      `label_drop($A, "env, nope")`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeSeries("cpu", data.Labels{"host": "web-1.us"}, tp{
+						time.Unix(5, 0), float64Pointer(1),
+					}),
+				},
+			},
+		},
+		{
+			name:      "label_keep",
+			expr:      `label_keep($A, "env")`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeSeries("cpu", data.Labels{"env": "prod"}, tp{
+						time.Unix(5, 0), float64Pointer(1),
+					}),
+				},
+			},
+		},
+		{
+			name:      "label_rename",
+			expr:      `label_rename($B, "instance", "host")`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeNumber("mem", data.Labels{"host": "db-1.eu"}, float64Pointer(2)),
+				},
+			},
+		},
+		{
+			name:      "label_replace with capture groups",
+			expr:      `label_replace($A, "region", "$2", "host", "(.*)\\.(.*)")`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeSeries("cpu", data.Labels{"host": "web-1.us", "env": "prod", "region": "us"}, tp{
+						time.Unix(5, 0), float64Pointer(1),
+					}),
+				},
+			},
+		},
+		{
+			name:      "label_replace without a match does nothing",
+			expr:      `label_replace($A, "region", "$1", "host", "db-(.*)")`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeSeries("cpu", data.Labels{"host": "web-1.us", "env": "prod"}, tp{
+						time.Unix(5, 0), float64Pointer(1),
+					}),
+				},
+			},
+		},
+		{
+			name:      "label_replace with an invalid regex",
+			expr:      `label_replace($A, "region", "$1", "host", "(")`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.Error,
+			results:   Results{},
+		},
+		{
+			name:      "relabelled results can be combined in binary math",
+			expr:      `label_keep(label_replace($A, "dc", "$1", "host", ".*\\.(.*)"), "dc") + label_replace(label_drop($B, "instance"), "dc", "us", "dc", "")`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeSeries("dc=us", data.Labels{"dc": "us"}, tp{
+						time.Unix(5, 0), float64Pointer(3),
+					}),
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			tt.newErrIs(t, err)
+			if e != nil {
+				res, err := e.Execute(vars)
+				tt.execErrIs(t, err)
+				if diff := cmp.Diff(tt.results, res, data.FrameTestCompareOptions()...); diff != "" {
+					t.Errorf("Result mismatch (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+	// The input vars are not modified.
+	assert.Equal(t, data.Labels{"host": "web-1.us", "env": "prod"}, vars["A"].Values[0].GetLabels())
+}
@@ -0,0 +1,248 @@
+package mathexp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// MatchType is the type of comparison a Matcher makes against a label value.
+type MatchType int
+
+const (
+	// MatchEqual matches label values equal to the Matcher's value (=).
+	MatchEqual MatchType = iota
+	// MatchNotEqual matches label values not equal to the Matcher's value (!=).
+	MatchNotEqual
+	// MatchRegexp matches label values that match the Matcher's regular expression (=~).
+	MatchRegexp
+	// MatchNotRegexp matches label values that do not match the Matcher's regular expression (!~).
+	MatchNotRegexp
+)
+
+// String returns the operator of the MatchType.
+func (m MatchType) String() string {
+	switch m {
+	case MatchEqual:
+		return "="
+	case MatchNotEqual:
+		return "!="
+	case MatchRegexp:
+		return "=~"
+	case MatchNotRegexp:
+		return "!~"
+	default:
+		return "unknown"
+	}
+}
+
+// Matcher is a Prometheus style label matcher such as host=~"web-.*".
+// A label that is not present is treated as having an empty value.
+type Matcher struct {
+	Type  MatchType
+	Name  string
+	Value string
+
+	re *regexp.Regexp
+}
+
+// NewMatcher creates a new Matcher. It will return an error if the
+// Matcher is a regular expression type and value is not a valid regular expression.
+func NewMatcher(t MatchType, name, value string) (*Matcher, error) {
+	m := &Matcher{
+		Type:  t,
+		Name:  name,
+		Value: value,
+	}
+	if t == MatchRegexp || t == MatchNotRegexp {
+		// Like Prometheus, the regular expression must match the whole value.
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q for label %v: %w", value, name, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// String returns the string representation of the Matcher.
+func (m *Matcher) String() string {
+	return fmt.Sprintf("%s%s%q", m.Name, m.Type, m.Value)
+}
+
+// Matches returns true if the label value v is matched by the Matcher.
+func (m *Matcher) Matches(v string) bool {
+	switch m.Type {
+	case MatchEqual:
+		return v == m.Value
+	case MatchNotEqual:
+		return v != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(v)
+	case MatchNotRegexp:
+		return !m.re.MatchString(v)
+	default:
+		return false
+	}
+}
+
+// Matchers is a set of Matchers that must all match.
+type Matchers []*Matcher
+
+// Matches returns true if all Matchers match the labels.
+func (ms Matchers) Matches(labels data.Labels) bool {
+	for _, m := range ms {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the string representation of the Matchers.
+func (ms Matchers) String() string {
+	s := make([]string, len(ms))
+	for i, m := range ms {
+		s[i] = m.String()
+	}
+	return "{" + strings.Join(s, ", ") + "}"
+}
+
+// ParseMatchers parses a comma separated list of label matchers such as
+// `host=~"web-.*", env!="staging"`. The list may be wrapped in curly braces.
+// Values may be double quoted (with Go escapes), single quoted (taken literally,
+// which is convenient for regular expressions), or bare if they contain no commas.
+func ParseMatchers(s string) (Matchers, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		s = s[1 : len(s)-1]
+	}
+	matchers := Matchers{}
+	p := &matcherParser{input: s}
+	for {
+		p.skipSpace()
+		if p.done() {
+			break
+		}
+		m, err := p.matcher()
+		if err != nil {
+			return nil, fmt.Errorf("invalid label matchers %q: %w", s, err)
+		}
+		matchers = append(matchers, m)
+		p.skipSpace()
+		if p.done() {
+			break
+		}
+		if p.input[p.pos] != ',' {
+			return nil, fmt.Errorf("invalid label matchers %q: expected ',' at position %v", s, p.pos)
+		}
+		p.pos++
+	}
+	return matchers, nil
+}
+
+// matcherParser holds the state for parsing a list of label matchers.
+type matcherParser struct {
+	input string
+	pos   int
+}
+
+func (p *matcherParser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *matcherParser) skipSpace() {
+	for !p.done() && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *matcherParser) matcher() (*Matcher, error) {
+	start := p.pos
+	for !p.done() {
+		r := rune(p.input[p.pos])
+		if !(r == '_' || unicode.IsLetter(r) || (p.pos > start && unicode.IsDigit(r))) {
+			break
+		}
+		p.pos++
+	}
+	name := p.input[start:p.pos]
+	if name == "" {
+		return nil, fmt.Errorf("expected label name at position %v", start)
+	}
+
+	p.skipSpace()
+	var t MatchType
+	rest := p.input[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, "=~"):
+		t = MatchRegexp
+	case strings.HasPrefix(rest, "!~"):
+		t = MatchNotRegexp
+	case strings.HasPrefix(rest, "!="):
+		t = MatchNotEqual
+	case strings.HasPrefix(rest, "="):
+		t = MatchEqual
+	default:
+		return nil, fmt.Errorf("expected one of =, !=, =~, !~ after label %v", name)
+	}
+	p.pos += len(t.String())
+
+	p.skipSpace()
+	value, err := p.value()
+	if err != nil {
+		return nil, fmt.Errorf("label %v: %w", name, err)
+	}
+	return NewMatcher(t, name, value)
+}
+
+func (p *matcherParser) value() (string, error) {
+	start := p.pos
+	if p.done() {
+		return "", nil
+	}
+	switch p.input[p.pos] {
+	case '"':
+		p.pos++
+		for !p.done() {
+			switch p.input[p.pos] {
+			case '\\':
+				p.pos += 2
+				continue
+			case '"':
+				p.pos++
+				return strconv.Unquote(p.input[start:p.pos])
+			}
+			p.pos++
+		}
+		return "", fmt.Errorf("unterminated quoted value")
+	case '\'':
+		end := strings.IndexByte(p.input[start+1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		p.pos = start + 1 + end + 1
+		return p.input[start+1 : p.pos-1], nil
+	default:
+		for !p.done() && p.input[p.pos] != ',' {
+			p.pos++
+		}
+		return strings.TrimSpace(p.input[start:p.pos]), nil
+	}
+}
+
+// Filter returns the values from the Results whose labels match all the Matchers.
+// The values themselves are not copied.
+func (r Results) Filter(ms Matchers) Results {
+	newRes := Results{Values: Values{}}
+	for _, val := range r.Values {
+		if ms.Matches(val.GetLabels()) {
+			newRes.Values = append(newRes.Values, val)
+		}
+	}
+	return newRes
+}
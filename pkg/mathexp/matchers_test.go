@@ -0,0 +1,161 @@
+package mathexp
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMatchers(t *testing.T) {
+	var tests = []struct {
+		name     string
+		matchers string
+		errIs    assert.ErrorAssertionFunc
+		result   string
+	}{
+		{
+			name:     "all match types",
+			matchers: `{host=~"web-.*", env!="staging", dc="us", role!~'db|cache'}`,
+			errIs:    assert.NoError,
+			result:   `{host=~"web-.*", env!="staging", dc="us", role!~"db|cache"}`,
+		},
+		{
+			name:     "bare values without braces",
+			matchers: `host = web-1 ,env!=prod`,
+			errIs:    assert.NoError,
+			result:   `{host="web-1", env!="prod"}`,
+		},
+		{
+			name:     "escaped double quotes",
+			matchers: `name="say \"hi\""`,
+			errIs:    assert.NoError,
+			result:   `{name="say \"hi\""}`,
+		},
+		{
+			name:     "empty matchers",
+			matchers: ``,
+			errIs:    assert.NoError,
+			result:   `{}`,
+		},
+		{
+			name:     "missing operator",
+			matchers: `host`,
+			errIs:    assert.Error,
+		},
+		{
+			name:     "missing label name",
+			matchers: `="web"`,
+			errIs:    assert.Error,
+		},
+		{
+			name:     "unterminated value",
+			matchers: `host="web`,
+			errIs:    assert.Error,
+		},
+		{
+			name:     "invalid regular expression",
+			matchers: `host=~"web-("`,
+			errIs:    assert.Error,
+		},
+		{
+			name:     "missing comma between matchers",
+			matchers: `host="a" env="b"`,
+			errIs:    assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms, err := ParseMatchers(tt.matchers)
+			tt.errIs(t, err)
+			if err == nil {
+				assert.Equal(t, tt.result, ms.String())
+			}
+		})
+	}
+}
+
+func TestMatchersMatches(t *testing.T) {
+	ms, err := ParseMatchers(`host=~"web-.*", env!="staging"`)
+	assert.NoError(t, err)
+	assert.True(t, ms.Matches(data.Labels{"host": "web-1", "env": "prod"}))
+	assert.True(t, ms.Matches(data.Labels{"host": "web-1"}))
+	assert.False(t, ms.Matches(data.Labels{"host": "web-1", "env": "staging"}))
+	assert.False(t, ms.Matches(data.Labels{"host": "db-web-1", "env": "prod"}))
+	assert.False(t, ms.Matches(nil))
+
+	ms, err = ParseMatchers(`env=""`)
+	assert.NoError(t, err)
+	assert.True(t, ms.Matches(nil), "a missing label matches an empty value")
+}
+
+func TestFilterFunc(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "web-1", "env": "prod"}, float64Pointer(1)),
+				makeNumber("", data.Labels{"host": "web-2", "env": "staging"}, float64Pointer(2)),
+				makeNumber("", data.Labels{"host": "db-1", "env": "prod"}, float64Pointer(3)),
+			},
+		},
+	}
+	var tests = []struct {
+		name      string
+		expr      string
+		newErrIs  assert.ErrorAssertionFunc
+		execErrIs assert.ErrorAssertionFunc
+		results   Results
+	}{
+		{
+			name:      "regexp and not equal",
+			expr:      `filter($A, "host=~\"web-.*\", env!=\"staging\"")`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeNumber("", data.Labels{"host": "web-1", "env": "prod"}, float64Pointer(1)),
+				},
+			},
+		},
+		{
+			name:      "single quoted values and math on the result",
+			expr:      `filter($A, "env='prod'") * 2`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeNumber(`env=prod, host=web-1`, data.Labels{"host": "web-1", "env": "prod"}, float64Pointer(2)),
+					makeNumber(`env=prod, host=db-1`, data.Labels{"host": "db-1", "env": "prod"}, float64Pointer(6)),
+				},
+			},
+		},
+		{
+			name:      "nothing matches",
+			expr:      `filter($A, "host=nope")`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.NoError,
+			results:   Results{Values{}},
+		},
+		{
+			name:      "invalid matchers error on execute",
+			expr:      `filter($A, "host")`,
+			newErrIs:  assert.NoError,
+			execErrIs: assert.Error,
+			results:   Results{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			tt.newErrIs(t, err)
+			if e != nil {
+				res, err := e.Execute(vars)
+				tt.execErrIs(t, err)
+				if diff := cmp.Diff(tt.results, res, data.FrameTestCompareOptions()...); diff != "" {
+					t.Errorf("Result mismatch (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package mathexp
+
+import (
+	"fmt"
+
+	"github.com/grafana/gel-app/pkg/mathexp/parse"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// matchSignature returns the labels of l that are used to match
+// results on either side of a binary operation.
+func matchSignature(l data.Labels, m *parse.VectorMatching) data.Labels {
+	sig := data.Labels{}
+	if m.On {
+		for _, name := range m.MatchingLabels {
+			if v, ok := l[name]; ok {
+				sig[name] = v
+			}
+		}
+		return sig
+	}
+	for k, v := range l {
+		sig[k] = v
+	}
+	for _, name := range m.MatchingLabels {
+		delete(sig, name)
+	}
+	return sig
+}
+
+// matchUnion creates Union objects like union, but the results are matched using
+// explicit label matching modifiers (on, ignoring, group_left, group_right) instead
+// of the default label matching rules.
+//
+// For one-to-one matching the labels of the Union are the labels used for matching.
+// For many-to-one (group_left) and one-to-many (group_right) matching the labels of
+// the Union are the labels of the "many" side, plus any Include labels copied from
+// the "one" side. It is an error for more than one result on a "one" side to have the
+// same matching labels.
+//
+// The pairs of results with different matching labels where either result is left
+// without any match are returned as DroppedUnions.
+func matchUnion(aResults, bResults Results, m *parse.VectorMatching) ([]*Union, []DroppedUnion, error) {
+	unions := []*Union{}
+	for _, vals := range []Values{aResults.Values, bResults.Values} {
+		for _, val := range vals {
+			if val.Type() == parse.TypeScalar {
+				return unions, nil, fmt.Errorf("label matching modifiers can not be used with scalars")
+			}
+		}
+	}
+
+	manyVals, oneVals, oneSide := aResults.Values, bResults.Values, "right"
+	if m.Card == parse.CardOneToMany {
+		manyVals, oneVals, oneSide = bResults.Values, aResults.Values, "left"
+	}
+
+	oneBySig := make(map[string]Value, len(oneVals))
+	for _, one := range oneVals {
+		sig := matchSignature(one.GetLabels(), m).String()
+		if _, ok := oneBySig[sig]; ok {
+			return unions, nil, fmt.Errorf("found duplicate results for the match group {%v} on the %v hand side of the operation", sig, oneSide)
+		}
+		oneBySig[sig] = one
+	}
+
+	matched := make(map[string]bool, len(manyVals))
+	manyMatched := make([]bool, len(manyVals))
+	oneMatched := make(map[string]bool, len(oneVals))
+	for i, many := range manyVals {
+		sig := matchSignature(many.GetLabels(), m)
+		one, ok := oneBySig[sig.String()]
+		if !ok {
+			continue
+		}
+		manyMatched[i] = true
+		oneMatched[sig.String()] = true
+
+		var labels data.Labels
+		if m.Card == parse.CardOneToOne {
+			if matched[sig.String()] {
+				return unions, nil, fmt.Errorf("found duplicate results for the match group {%v} on the left hand side of the operation, use group_left or group_right for many-to-one matching", sig)
+			}
+			matched[sig.String()] = true
+			labels = sig
+		} else {
+			labels = data.Labels{}
+			for k, v := range many.GetLabels() {
+				labels[k] = v
+			}
+			oneLabels := one.GetLabels()
+			for _, name := range m.Include {
+				if v, ok := oneLabels[name]; ok {
+					labels[name] = v
+				} else {
+					delete(labels, name)
+				}
+			}
+		}
+
+		u := &Union{Labels: labels, A: many, B: one}
+		if m.Card == parse.CardOneToMany {
+			u.A, u.B = one, many
+		}
+		unions = append(unions, u)
+	}
+
+	var dropped []DroppedUnion
+	for i, many := range manyVals {
+		manySig := matchSignature(many.GetLabels(), m).String()
+		for _, one := range oneVals {
+			oneSig := matchSignature(one.GetLabels(), m).String()
+			if manySig == oneSig || (manyMatched[i] && oneMatched[oneSig]) {
+				continue
+			}
+			d := DroppedUnion{ALabels: many.GetLabels(), BLabels: one.GetLabels()}
+			if m.Card == parse.CardOneToMany {
+				d.ALabels, d.BLabels = d.BLabels, d.ALabels
+			}
+			dropped = append(dropped, d)
+		}
+	}
+	return unions, dropped, nil
+}
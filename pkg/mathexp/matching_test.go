@@ -0,0 +1,150 @@
+package mathexp
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVectorMatching(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "a", "cpu": "0"}, float64Pointer(1)),
+				makeNumber("", data.Labels{"host": "a", "cpu": "1"}, float64Pointer(2)),
+				makeNumber("", data.Labels{"host": "b", "cpu": "0"}, float64Pointer(3)),
+			},
+		},
+		"B": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "a", "region": "us"}, float64Pointer(10)),
+				makeNumber("", data.Labels{"host": "b", "region": "eu"}, float64Pointer(20)),
+			},
+		},
+		"C": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "a", "instance": "1"}, float64Pointer(100)),
+				makeNumber("", data.Labels{"host": "c", "instance": "2"}, float64Pointer(200)),
+			},
+		},
+	}
+	var tests = []struct {
+		name      string
+		expr      string
+		execErrIs assert.ErrorAssertionFunc
+		results   Results
+	}{
+		{
+			name:      "default matching drops pairs with different labels",
+			expr:      "$B + $C",
+			execErrIs: assert.NoError,
+			results:   Results{Values{}},
+		},
+		{
+			name:      "on matches on the listed labels only",
+			expr:      "$B + on(host) $C",
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeNumber("host=a", data.Labels{"host": "a"}, float64Pointer(110)),
+				},
+			},
+		},
+		{
+			name:      "ignoring matches on all but the listed labels",
+			expr:      "label_drop($B, \"region\") + ignoring(instance) $C",
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeNumber("host=a", data.Labels{"host": "a"}, float64Pointer(110)),
+				},
+			},
+		},
+		{
+			name:      "one to one with duplicates errors",
+			expr:      "$A + on(host) $B",
+			execErrIs: assert.Error,
+			results:   Results{},
+		},
+		{
+			name:      "group_left copies include labels from the one side",
+			expr:      "$A * on(host) group_left(region) $B",
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeNumber("cpu=0, host=a, region=us", data.Labels{"host": "a", "cpu": "0", "region": "us"}, float64Pointer(10)),
+					makeNumber("cpu=1, host=a, region=us", data.Labels{"host": "a", "cpu": "1", "region": "us"}, float64Pointer(20)),
+					makeNumber("cpu=0, host=b, region=eu", data.Labels{"host": "b", "cpu": "0", "region": "eu"}, float64Pointer(60)),
+				},
+			},
+		},
+		{
+			name:      "group_right keeps the operand order",
+			expr:      "$B - on(host) group_right $A",
+			execErrIs: assert.NoError,
+			results: Results{
+				[]Value{
+					makeNumber("cpu=0, host=a", data.Labels{"host": "a", "cpu": "0"}, float64Pointer(9)),
+					makeNumber("cpu=1, host=a", data.Labels{"host": "a", "cpu": "1"}, float64Pointer(8)),
+					makeNumber("cpu=0, host=b", data.Labels{"host": "b", "cpu": "0"}, float64Pointer(17)),
+				},
+			},
+		},
+		{
+			name:      "group_left with duplicates on the one side errors",
+			expr:      "$B * on(host) group_left $A",
+			execErrIs: assert.Error,
+			results:   Results{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			assert.NoError(t, err)
+			if e != nil {
+				res, err := e.Execute(vars)
+				tt.execErrIs(t, err)
+				if diff := cmp.Diff(tt.results, res, data.FrameTestCompareOptions()...); diff != "" {
+					t.Errorf("Result mismatch (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestVectorMatchingDroppedUnions(t *testing.T) {
+	vars := Vars{
+		"B": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "a", "region": "us"}, float64Pointer(10)),
+				makeNumber("", data.Labels{"host": "b", "region": "eu"}, float64Pointer(20)),
+			},
+		},
+		"C": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "a", "instance": "1"}, float64Pointer(100)),
+				makeNumber("", data.Labels{"host": "c", "instance": "2"}, float64Pointer(200)),
+			},
+		},
+	}
+	e, err := New("$B + on(host) $C")
+	assert.NoError(t, err)
+	res, notices, err := e.ExecuteWithNotices(vars, Options{})
+	assert.NoError(t, err)
+	assert.Len(t, res.Values, 1)
+	// host=b on the left and host=c on the right are left without a match.
+	assert.Equal(t, []data.Notice{{
+		Severity: data.NoticeSeverityWarning,
+		Text:     "3 combination(s) of results in $B + on(host) $C were dropped because their labels do not match, e.g. {host=a, region=us} and {host=c, instance=2}",
+	}}, notices)
+
+	// Nothing is dropped when every result is matched.
+	e, err = New("$B + on(host) label_replace($C, \"host\", \"b\", \"host\", \"c\")")
+	assert.NoError(t, err)
+	res, notices, err = e.ExecuteWithNotices(vars, Options{})
+	assert.NoError(t, err)
+	assert.Len(t, res.Values, 2)
+	assert.Empty(t, notices)
+}
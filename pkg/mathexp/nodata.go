@@ -0,0 +1,31 @@
+package mathexp
+
+// NoData returns true if r has no values, or if none of its values has a value that
+// is not null or NaN. This is the case when a datasource returns no series, or only
+// series of null points.
+func (r Results) NoData() bool {
+	for _, val := range r.Values {
+		if hasData(val) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasData returns true if val is a Scalar or Number that is not null or NaN, or a
+// Series with a point that is not null or NaN.
+func hasData(val Value) bool {
+	switch v := val.(type) {
+	case Scalar:
+		return !missing(v.GetFloat64Value())
+	case Number:
+		return !missing(v.GetFloat64Value())
+	case Series:
+		for i := 0; i < v.Len(); i++ {
+			if _, f := v.GetPoint(i); !missing(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
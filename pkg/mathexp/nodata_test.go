@@ -0,0 +1,84 @@
+package mathexp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoDataFuncs(t *testing.T) {
+	vars := Vars{
+		"Empty": Results{},
+		"NullSeries": Results{
+			[]Value{
+				makeSeries("", data.Labels{"host": "a"}, tp{
+					time.Unix(0, 0), nil,
+				}, tp{
+					time.Unix(1, 0), NaN,
+				}),
+				makeSeries("", data.Labels{"host": "b"}),
+			},
+		},
+		"Series": Results{
+			[]Value{
+				makeSeries("", data.Labels{"host": "a"}, tp{
+					time.Unix(0, 0), nil,
+				}, tp{
+					time.Unix(1, 0), float64Pointer(0),
+				}),
+				makeSeries("", data.Labels{"host": "b"}),
+			},
+		},
+		"NullNumbers": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "a"}, nil),
+			},
+		},
+		"Numbers": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "a"}, nil),
+				makeNumber("", data.Labels{"host": "b"}, float64Pointer(0)),
+				makeNumber("", data.Labels{"host": "c"}, float64Pointer(1)),
+			},
+		},
+	}
+	number := func(f float64) Results {
+		return Results{[]Value{makeNumber("", nil, float64Pointer(f))}}
+	}
+	var tests = []struct {
+		name    string
+		expr    string
+		results Results
+	}{
+		{"absent empty", "absent($Empty)", number(1)},
+		{"absent null and NaN series", "absent($NullSeries)", number(1)},
+		{"absent series with a value", "absent($Series)", number(0)},
+		{"absent null numbers", "absent($NullNumbers)", number(1)},
+		{"absent numbers with a value", "absent($Numbers)", number(0)},
+		{"absent scalar", "absent(1)", number(0)},
+		{"absent in condition", "absent($Empty) || $Numbers > 0", Results{[]Value{
+			makeNumber("host=a", data.Labels{"host": "a"}, nil),
+			makeNumber("host=b", data.Labels{"host": "b"}, float64Pointer(1)),
+			makeNumber("host=c", data.Labels{"host": "c"}, float64Pointer(1)),
+		}}},
+		{"count_series empty", "count_series($Empty)", number(0)},
+		{"count_series series", "count_series($NullSeries)", number(2)},
+		{"count_series numbers", "count_series($Numbers)", number(3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			res, err := e.Execute(vars)
+			assert.NoError(t, err)
+			if diff := cmp.Diff(tt.results, res, data.FrameTestCompareOptions()...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
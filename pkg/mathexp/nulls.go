@@ -0,0 +1,293 @@
+package mathexp
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// NullMode is how null values are handled by functions, reducers, the ternary operator,
+// and unary and binary operations in an expression. The fill functions and
+// the ?? operator replace nulls themselves, so the mode does not apply to them.
+type NullMode int
+
+const (
+	// NullModeDefault keeps the historical behavior: functions of a point turn nulls
+	// into NaN, functions over several points such as rate and moving_avg ignore nulls,
+	// unary and binary operations keep nulls, and aggregations skip nulls.
+	NullModeDefault NullMode = iota
+	// NullModeSkip skips nulls: series points with a null are dropped from the result,
+	// reducers ignore nulls, and operations on a single null value result in null.
+	NullModeSkip
+	// NullModeZero treats nulls as zero.
+	NullModeZero
+	// NullModeNull propagates nulls: any operation on a null results in null, and a
+	// reduction over any null results in null.
+	NullModeNull
+	// NullModeNaN propagates NaN: any operation on a null results in NaN, and a
+	// reduction over any null results in NaN.
+	NullModeNaN
+)
+
+// ParseNullMode returns a NullMode from its string representation.
+// An empty string is the default of NullModeDefault.
+func ParseNullMode(s string) (NullMode, error) {
+	switch s {
+	case "", "default":
+		return NullModeDefault, nil
+	case "skip":
+		return NullModeSkip, nil
+	case "zero":
+		return NullModeZero, nil
+	case "null":
+		return NullModeNull, nil
+	case "nan":
+		return NullModeNaN, nil
+	default:
+		return NullModeDefault, fmt.Errorf("null mode %v not implemented", s)
+	}
+}
+
+func (m NullMode) String() string {
+	switch m {
+	case NullModeDefault:
+		return "default"
+	case NullModeSkip:
+		return "skip"
+	case NullModeZero:
+		return "zero"
+	case NullModeNull:
+		return "null"
+	case NullModeNaN:
+		return "nan"
+	default:
+		return "unknown"
+	}
+}
+
+// float64Ptr returns a pointer to a copy of f.
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+// floatOp applies floatF to f, which is the input to a function. skip is true
+// if the point should be left out of a series result.
+func (m NullMode) floatOp(f *float64, floatF func(x float64) float64) (r *float64, skip bool) {
+	if f != nil {
+		return float64Ptr(floatF(*f)), false
+	}
+	switch m {
+	case NullModeSkip:
+		return nil, true
+	case NullModeZero:
+		return float64Ptr(floatF(0)), false
+	case NullModeNull:
+		return nil, false
+	default: // NullModeDefault and NullModeNaN
+		return float64Ptr(math.NaN()), false
+	}
+}
+
+// unaryOp performs the unary operation op on f. skip is true
+// if the point should be left out of a series result.
+func (m NullMode) unaryOp(op string, f *float64) (r *float64, skip bool, err error) {
+	if f == nil {
+		switch m {
+		case NullModeSkip:
+			return nil, true, nil
+		case NullModeZero:
+			f = float64Ptr(0)
+		case NullModeNaN:
+			return float64Ptr(math.NaN()), false, nil
+		default: // NullModeDefault and NullModeNull
+			return nil, false, nil
+		}
+	}
+	newF, err := unaryOp(op, *f)
+	if err != nil {
+		return nil, false, err
+	}
+	return &newF, false, nil
+}
+
+// binaryOp performs the binary operation op on a and b. skip is true
+// if the point should be left out of a series result.
+func (m NullMode) binaryOp(op string, a, b *float64) (r *float64, skip bool, err error) {
+	if op == "??" && (a == nil || b == nil) {
+		// Null coalescing handles nulls itself, so the mode does not apply.
+		if a == nil {
+			return b, false, nil
+		}
+		return a, false, nil
+	}
+	if a == nil || b == nil {
+		switch m {
+		case NullModeSkip:
+			return nil, true, nil
+		case NullModeZero:
+			if a == nil {
+				a = float64Ptr(0)
+			}
+			if b == nil {
+				b = float64Ptr(0)
+			}
+		case NullModeNaN:
+			return float64Ptr(math.NaN()), false, nil
+		default: // NullModeDefault and NullModeNull
+			return nil, false, nil
+		}
+	}
+	newF, err := binaryOp(op, *a, *b)
+	if err != nil {
+		return nil, false, err
+	}
+	return &newF, false, nil
+}
+
+// ternaryOp returns a if c is non-zero and b if c is zero, for the ternary operation
+// c ? a : b. If c is NaN the result is NaN. A null c, or a null chosen value, is handled
+// like a null operand of a binary operation, except that NullModeDefault keeps the
+// chosen value as is. skip is true if the point should be left out of a series result.
+func (m NullMode) ternaryOp(c, a, b *float64) (r *float64, skip bool) {
+	if c == nil {
+		switch m {
+		case NullModeSkip:
+			return nil, true
+		case NullModeZero:
+			c = float64Ptr(0)
+		case NullModeNaN:
+			return float64Ptr(math.NaN()), false
+		default: // NullModeDefault and NullModeNull
+			return nil, false
+		}
+	}
+	switch {
+	case math.IsNaN(*c):
+		return c, false
+	case *c != 0:
+		r = a
+	default:
+		r = b
+	}
+	if r != nil || m == NullModeDefault {
+		return r, false
+	}
+	switch m {
+	case NullModeSkip:
+		return nil, true
+	case NullModeZero:
+		return float64Ptr(0), false
+	case NullModeNaN:
+		return float64Ptr(math.NaN()), false
+	default: // NullModeNull
+		return nil, false
+	}
+}
+
+// reduceInputs returns the values to reduce from vals. If ok is false the
+// reduction is null or NaN instead, as returned by r.
+func (m NullMode) reduceInputs(vals []*float64) (floats []float64, r *float64, ok bool) {
+	floats = make([]float64, 0, len(vals))
+	for _, f := range vals {
+		if f != nil {
+			floats = append(floats, *f)
+			continue
+		}
+		switch m {
+		case NullModeZero:
+			floats = append(floats, 0)
+		case NullModeNull:
+			return nil, nil, false
+		case NullModeNaN:
+			return nil, float64Ptr(math.NaN()), false
+		}
+	}
+	return floats, nil, true
+}
+
+// seriesFunc returns seriesF with the NullMode applied, for series functions such as
+// rate and moving_avg that combine several points and ignore null values themselves.
+// See seriesFuncWithError.
+func (m NullMode) seriesFunc(seriesF func(s Series) Series) func(s Series) Series {
+	return func(s Series) Series {
+		res, _ := m.seriesFuncWithError(func(s Series) (Series, error) {
+			return seriesF(s), nil
+		})(s)
+		return res
+	}
+}
+
+// seriesFuncWithError returns seriesF with the NullMode applied. NullModeDefault keeps
+// the behavior of seriesF. NullModeSkip drops the null points of the input, and
+// NullModeZero treats them as zero. NullModeNull and NullModeNaN run seriesF over the
+// points that are not null, and then the result is null or NaN at the time of each
+// null point of the input.
+func (m NullMode) seriesFuncWithError(seriesF func(s Series) (Series, error)) func(s Series) (Series, error) {
+	return func(s Series) (Series, error) {
+		switch m {
+		case NullModeSkip, NullModeZero:
+			return seriesF(m.replaceNulls(s))
+		case NullModeNull, NullModeNaN:
+			res, err := seriesF(s)
+			if err != nil {
+				return res, err
+			}
+			return m.propagateNulls(s, res), nil
+		default:
+			return seriesF(s)
+		}
+	}
+}
+
+// replaceNulls returns s with its null points dropped for NullModeSkip, or replaced
+// with zero for NullModeZero.
+func (m NullMode) replaceNulls(s Series) Series {
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, s.ValueIsNullabe, 0)
+	for i := 0; i < s.Len(); i++ {
+		t, f := s.GetPoint(i)
+		if f == nil {
+			if m == NullModeSkip {
+				continue
+			}
+			f = float64Ptr(0)
+		}
+		newSeries.AppendPoint(newSeries.Len(), t, f)
+	}
+	return newSeries
+}
+
+// propagateNulls returns res, the result of a series function on s, with a null point
+// for NullModeNull, or a NaN point for NullModeNaN, at the time of each null point of s.
+// Points are sorted by time and points with null times are dropped.
+func (m NullMode) propagateNulls(s, res Series) Series {
+	var nullTimes []time.Time
+	for _, p := range sortedPoints(s) {
+		if p.f == nil {
+			nullTimes = append(nullTimes, p.t)
+		}
+	}
+	if len(nullTimes) == 0 {
+		return res
+	}
+	var nullF *float64
+	if m == NullModeNaN {
+		nullF = float64Ptr(math.NaN())
+	}
+	newSeries := NewSeries(res.GetName(), res.GetLabels(), res.TimeIdx, res.TimeIsNullable, res.ValueIdx, true, 0)
+	points := sortedPoints(res)
+	for i, j := 0, 0; i < len(points) || j < len(nullTimes); {
+		switch {
+		case j == len(nullTimes) || (i < len(points) && points[i].t.Before(nullTimes[j])):
+			newSeries.AppendPoint(newSeries.Len(), &points[i].t, points[i].f)
+			i++
+		case i < len(points) && points[i].t.Equal(nullTimes[j]):
+			newSeries.AppendPoint(newSeries.Len(), &points[i].t, nullF)
+			i++
+			j++
+		default:
+			newSeries.AppendPoint(newSeries.Len(), &nullTimes[j], nullF)
+			j++
+		}
+	}
+	return newSeries
+}
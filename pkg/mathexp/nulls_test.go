@@ -0,0 +1,183 @@
+package mathexp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNullMode(t *testing.T) {
+	for _, s := range []string{"default", "skip", "zero", "null", "nan"} {
+		m, err := ParseNullMode(s)
+		assert.NoError(t, err)
+		assert.Equal(t, s, m.String())
+	}
+	m, err := ParseNullMode("")
+	assert.NoError(t, err)
+	assert.Equal(t, NullModeDefault, m)
+	_, err = ParseNullMode("foo")
+	assert.Error(t, err)
+}
+
+func TestNullModes(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeSeries("", nil, tp{
+					time.Unix(0, 0), float64Pointer(-1),
+				}, tp{
+					time.Unix(1, 0), nil,
+				}, tp{
+					time.Unix(2, 0), float64Pointer(3),
+				}),
+			},
+		},
+		"B": Results{
+			[]Value{
+				makeSeries("", nil, tp{
+					time.Unix(0, 0), float64Pointer(10),
+				}, tp{
+					time.Unix(1, 0), float64Pointer(20),
+				}, tp{
+					time.Unix(2, 0), nil,
+				}),
+			},
+		},
+		"N":    Results{[]Value{makeNumber("", nil, float64Pointer(2))}},
+		"Null": Results{[]Value{makeNumber("", nil, nil)}},
+	}
+	// series returns a series with the given values at times 0, 1 and 2.
+	series := func(f0, f1, f2 *float64) Results {
+		return Results{[]Value{makeSeries("", nil, tp{
+			time.Unix(0, 0), f0,
+		}, tp{
+			time.Unix(1, 0), f1,
+		}, tp{
+			time.Unix(2, 0), f2,
+		})}}
+	}
+	skipped := func(f0, f2 *float64) Results {
+		return Results{[]Value{makeSeries("", nil, tp{
+			time.Unix(0, 0), f0,
+		}, tp{
+			time.Unix(2, 0), f2,
+		})}}
+	}
+	points := func(tps ...tp) Results {
+		return Results{[]Value{makeSeries("", nil, tps...)}}
+	}
+	number := func(f *float64) Results {
+		return Results{[]Value{makeNumber("", nil, f)}}
+	}
+
+	var tests = []struct {
+		name     string
+		expr     string
+		nullMode NullMode
+		results  Results
+	}{
+		// Functions
+		{"function default turns null into NaN", "abs($A)", NullModeDefault, series(float64Pointer(1), NaN, float64Pointer(3))},
+		{"function skip drops null points", "abs($A)", NullModeSkip, skipped(float64Pointer(1), float64Pointer(3))},
+		{"function zero treats null as zero", "abs($A)", NullModeZero, series(float64Pointer(1), float64Pointer(0), float64Pointer(3))},
+		{"function null propagates null", "abs($A)", NullModeNull, series(float64Pointer(1), nil, float64Pointer(3))},
+		{"function nan propagates NaN", "abs($A)", NullModeNaN, series(float64Pointer(1), NaN, float64Pointer(3))},
+
+		// Functions over several points
+		{"delta default ignores null", "delta($A)", NullModeDefault, points(tp{time.Unix(2, 0), float64Pointer(4)})},
+		{"delta skip drops null points", "delta($A)", NullModeSkip, points(tp{time.Unix(2, 0), float64Pointer(4)})},
+		{"delta zero treats null as zero", "delta($A)", NullModeZero, points(tp{time.Unix(1, 0), float64Pointer(1)}, tp{time.Unix(2, 0), float64Pointer(3)})},
+		{"delta null propagates null", "delta($A)", NullModeNull, points(tp{time.Unix(1, 0), nil}, tp{time.Unix(2, 0), float64Pointer(4)})},
+		{"delta nan propagates NaN", "delta($A)", NullModeNaN, points(tp{time.Unix(1, 0), NaN}, tp{time.Unix(2, 0), float64Pointer(4)})},
+		{"moving_sum default ignores null", `moving_sum($A, "2")`, NullModeDefault, series(float64Pointer(-1), float64Pointer(-1), float64Pointer(3))},
+		{"moving_sum skip drops null points", `moving_sum($A, "2")`, NullModeSkip, skipped(float64Pointer(-1), float64Pointer(2))},
+		{"moving_sum zero treats null as zero", `moving_sum($A, "2")`, NullModeZero, series(float64Pointer(-1), float64Pointer(-1), float64Pointer(3))},
+		{"moving_sum null propagates null", `moving_sum($A, "2")`, NullModeNull, series(float64Pointer(-1), nil, float64Pointer(3))},
+		{"moving_sum nan propagates NaN", `moving_sum($A, "2")`, NullModeNaN, series(float64Pointer(-1), NaN, float64Pointer(3))},
+		{"fill_previous is not affected by the mode", "fill_previous($A)", NullModeNull, series(float64Pointer(-1), float64Pointer(-1), float64Pointer(3))},
+
+		// Unary operations
+		{"unary default keeps null", "-$A", NullModeDefault, series(float64Pointer(1), nil, float64Pointer(-3))},
+		{"unary skip drops null points", "-$A", NullModeSkip, skipped(float64Pointer(1), float64Pointer(-3))},
+		{"unary zero treats null as zero", "-$A", NullModeZero, series(float64Pointer(1), float64Pointer(0), float64Pointer(-3))},
+		{"unary null propagates null", "-$A", NullModeNull, series(float64Pointer(1), nil, float64Pointer(-3))},
+		{"unary nan propagates NaN", "-$A", NullModeNaN, series(float64Pointer(1), NaN, float64Pointer(-3))},
+
+		// Binary operations
+		{"binary series default keeps null", "$A + $B", NullModeDefault, series(float64Pointer(9), nil, nil)},
+		{"binary series skip drops null points", "$A + $B", NullModeSkip, Results{[]Value{makeSeries("", nil, tp{time.Unix(0, 0), float64Pointer(9)})}}},
+		{"binary series zero treats null as zero", "$A + $B", NullModeZero, series(float64Pointer(9), float64Pointer(20), float64Pointer(3))},
+		{"binary series null propagates null", "$A + $B", NullModeNull, series(float64Pointer(9), nil, nil)},
+		{"binary series nan propagates NaN", "$A + $B", NullModeNaN, series(float64Pointer(9), NaN, NaN)},
+		{"binary number default keeps null", "$N + $Null", NullModeDefault, number(nil)},
+		{"binary number skip is null", "$N + $Null", NullModeSkip, number(nil)},
+		{"binary number zero treats null as zero", "$N + $Null", NullModeZero, number(float64Pointer(2))},
+		{"binary number null propagates null", "$N + $Null", NullModeNull, number(nil)},
+		{"binary number nan propagates NaN", "$N + $Null", NullModeNaN, number(NaN)},
+	}
+	opt := cmp.Comparer(func(x, y float64) bool {
+		return (math.IsNaN(x) && math.IsNaN(y)) || x == y
+	})
+	options := append([]cmp.Option{opt}, data.FrameTestCompareOptions()...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			assert.NoError(t, err)
+			res, err := e.ExecuteWithOptions(vars, Options{NullMode: tt.nullMode})
+			assert.NoError(t, err)
+			if diff := cmp.Diff(tt.results, res, options...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReduceNullModes(t *testing.T) {
+	s := makeSeries("", nil, tp{
+		time.Unix(0, 0), float64Pointer(1),
+	}, tp{
+		time.Unix(1, 0), nil,
+	}, tp{
+		time.Unix(2, 0), float64Pointer(3),
+	})
+	numbers := Results{[]Value{
+		makeNumber("", nil, float64Pointer(1)),
+		makeNumber("", nil, nil),
+		makeNumber("", nil, float64Pointer(3)),
+	}}
+	var tests = []struct {
+		nullMode  NullMode
+		reduce    *float64
+		aggregate *float64
+	}{
+		{NullModeDefault, NaN, float64Pointer(2)},
+		{NullModeSkip, float64Pointer(2), float64Pointer(2)},
+		{NullModeZero, float64Pointer(4.0 / 3), float64Pointer(4.0 / 3)},
+		{NullModeNull, nil, nil},
+		{NullModeNaN, NaN, NaN},
+	}
+	opt := cmp.Comparer(func(x, y float64) bool {
+		return (math.IsNaN(x) && math.IsNaN(y)) || x == y
+	})
+	for _, tt := range tests {
+		t.Run(tt.nullMode.String(), func(t *testing.T) {
+			n, err := s.ReduceWithNullMode("mean", tt.nullMode)
+			assert.NoError(t, err)
+			if diff := cmp.Diff(tt.reduce, n.GetFloat64Value(), opt); diff != "" {
+				t.Errorf("Reduce mismatch (-want +got):\n%s", diff)
+			}
+
+			res, err := numbers.AggregateWithNullMode(Aggregator{Name: "mean"}, Grouping{}, tt.nullMode)
+			assert.NoError(t, err)
+			if assert.Len(t, res.Values, 1) {
+				if diff := cmp.Diff(tt.aggregate, res.Values[0].(Number).GetFloat64Value(), opt); diff != "" {
+					t.Errorf("Aggregate mismatch (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
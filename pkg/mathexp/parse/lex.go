@@ -56,8 +56,11 @@ const (
 	itemRightParen
 	itemString
 	itemFunc
-	itemVar // e.g. $A
-	itemPow // '**'
+	itemVar      // e.g. $A
+	itemPow      // '**'
+	itemQuestion // '?'
+	itemCoalesce // '??'
+	itemColon    // ':'
 )
 
 const eof = -1
@@ -188,6 +191,15 @@ Loop:
 			return lexString
 		case r == ',':
 			l.emit(itemComma)
+		case r == '?':
+			if l.peek() == '?' {
+				l.next()
+				l.emit(itemCoalesce)
+			} else {
+				l.emit(itemQuestion)
+			}
+		case r == ':':
+			l.emit(itemColon)
 		case isSpace(r):
 			l.ignore()
 		case r == eof:
@@ -274,7 +286,7 @@ func lexSymbol(l *lexer) stateFn {
 func lexFunc(l *lexer) stateFn {
 	for {
 		switch r := l.next(); {
-		case unicode.IsLetter(r):
+		case isVarchar(r):
 			// absorb
 		default:
 			l.backup()
@@ -308,6 +320,11 @@ func lexString(l *lexer) stateFn {
 		case '"':
 			l.emit(itemString)
 			return lexItem
+		case '\\':
+			if r := l.next(); r != eof && r != '\n' {
+				break
+			}
+			fallthrough
 		case eof:
 			return l.errorf("unterminated string")
 		}
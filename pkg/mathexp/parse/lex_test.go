@@ -74,6 +74,7 @@ var lexTests = []lexTest{
 	{"empty", "", []item{tEOF}},
 	{"spaces", " \t\n", []item{tEOF}},
 	{"text", `"now is the time"`, []item{{itemString, 0, `"now is the time"`}, tEOF}},
+	{"text with escaped quotes", `"host=~\"web-.*\""`, []item{{itemString, 0, `"host=~\"web-.*\""`}, tEOF}},
 	{"operators", "! && || < > <= >= == != + - * / %", []item{
 		tNot,
 		tAnd,
@@ -106,10 +107,24 @@ var lexTests = []lexTest{
 		{itemVar, 0, "$A"},
 		tEOF,
 	}},
+	{"func with underscore and digits", `label_set($A) log10(1)`, []item{
+		{itemFunc, 0, "label_set"},
+		tLpar,
+		{itemVar, 0, "$A"},
+		tRpar,
+		{itemFunc, 0, "log10"},
+		tLpar,
+		{itemNumber, 0, "1"},
+		tRpar,
+		tEOF,
+	}},
 	// errors
 	{"unclosed quote", "\"", []item{
 		{itemError, 0, "unterminated string"},
 	}},
+	{"unclosed escaped quote", `"\"`, []item{
+		{itemError, 0, "unterminated string"},
+	}},
 	{"single quote", "'single quote is invalid'", []item{
 		{itemError, 0, "invalid character: '"},
 	}},
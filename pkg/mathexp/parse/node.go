@@ -9,6 +9,7 @@ package parse
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 var textFormat = "%s" // Changed to "%q" in tests for better error messages.
@@ -64,6 +65,8 @@ const (
 	NodeNumber
 	// NodeVar is variable: $A
 	NodeVar
+	// NodeTernary is the conditional operator: cond ? a : b
+	NodeTernary
 )
 
 // String returns the string representation of the NodeType
@@ -79,6 +82,8 @@ func (t NodeType) String() string {
 		return "NodeString"
 	case NodeNumber:
 		return "NodeNumber"
+	case NodeTernary:
+		return "NodeTernary"
 	default:
 		return "NodeUnknown"
 	}
@@ -302,6 +307,9 @@ type BinaryNode struct {
 	Args     [2]Node
 	Operator item
 	OpStr    string
+	// Matching is set when the operator has label matching modifiers,
+	// e.g. $A + on(host) $B. When nil the default label matching is used.
+	Matching *VectorMatching
 }
 
 func newBinary(operator item, arg1, arg2 Node) *BinaryNode {
@@ -310,16 +318,34 @@ func newBinary(operator item, arg1, arg2 Node) *BinaryNode {
 
 // String returns the string representation of the BinaryNode so it fulfills the Node interface.
 func (b *BinaryNode) String() string {
+	if b.Matching != nil {
+		return fmt.Sprintf("%s %s %s %s", b.Args[0], b.Operator.val, b.Matching, b.Args[1])
+	}
 	return fmt.Sprintf("%s %s %s", b.Args[0], b.Operator.val, b.Args[1])
 }
 
 // StringAST returns the string representation of abstract syntax tree of the BinaryNode so it fulfills the Node interface.
 func (b *BinaryNode) StringAST() string {
+	if b.Matching != nil {
+		return fmt.Sprintf("%s %s(%s, %s)", b.Operator.val, b.Matching, b.Args[0], b.Args[1])
+	}
 	return fmt.Sprintf("%s(%s, %s)", b.Operator.val, b.Args[0], b.Args[1])
 }
 
 // Check performs parse time checking on the BinaryNode so it fulfills the Node interface.
 func (b *BinaryNode) Check(t *Tree) error {
+	if b.Matching != nil {
+		for _, arg := range b.Args {
+			if arg.Return() == TypeScalar {
+				return fmt.Errorf("parse: label matching modifiers can not be used with scalars in %s", b)
+			}
+		}
+	}
+	for _, arg := range b.Args {
+		if err := arg.Check(t); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -333,6 +359,48 @@ func (b *BinaryNode) Return() ReturnType {
 	return t0
 }
 
+// VectorMatchCardinality is the cardinality of the label matching between
+// the two sides of a binary operation.
+type VectorMatchCardinality int
+
+const (
+	// CardOneToOne matches each result on one side to at most one result on the other side.
+	CardOneToOne VectorMatchCardinality = iota
+	// CardManyToOne matches many results on the left side to one result on the right side (group_left).
+	CardManyToOne
+	// CardOneToMany matches one result on the left side to many results on the right side (group_right).
+	CardOneToMany
+)
+
+// VectorMatching describes how results on both sides of a binary operation are
+// matched by their labels, e.g. on(host) group_left(region).
+type VectorMatching struct {
+	Card VectorMatchCardinality
+	// On is true when matching on MatchingLabels, and false
+	// when matching on all labels but MatchingLabels (ignoring).
+	On             bool
+	MatchingLabels []string
+	// Include are the labels copied from the "one" side for
+	// many-to-one and one-to-many matching.
+	Include []string
+}
+
+// String returns the string representation of the VectorMatching.
+func (m *VectorMatching) String() string {
+	s := "ignoring"
+	if m.On {
+		s = "on"
+	}
+	s += "(" + strings.Join(m.MatchingLabels, ", ") + ")"
+	switch m.Card {
+	case CardManyToOne:
+		s += " group_left(" + strings.Join(m.Include, ", ") + ")"
+	case CardOneToMany:
+		s += " group_right(" + strings.Join(m.Include, ", ") + ")"
+	}
+	return s
+}
+
 // UnaryNode holds one argument and an operator.
 type UnaryNode struct {
 	NodeType
@@ -371,6 +439,56 @@ func (u *UnaryNode) Return() ReturnType {
 	return u.Arg.Return()
 }
 
+// TernaryNode holds a condition and the two arguments it chooses between.
+type TernaryNode struct {
+	NodeType
+	Pos
+	Cond Node
+	Args [2]Node
+}
+
+func newTernary(pos Pos, cond, arg1, arg2 Node) *TernaryNode {
+	return &TernaryNode{NodeType: NodeTernary, Pos: pos, Cond: cond, Args: [2]Node{arg1, arg2}}
+}
+
+// String returns the string representation of the TernaryNode so it fulfills the Node interface.
+func (n *TernaryNode) String() string {
+	return fmt.Sprintf("%s ? %s : %s", n.Cond, n.Args[0], n.Args[1])
+}
+
+// StringAST returns the string representation of abstract syntax tree of the TernaryNode so it fulfills the Node interface.
+func (n *TernaryNode) StringAST() string {
+	return fmt.Sprintf("?:(%s, %s, %s)", n.Cond, n.Args[0], n.Args[1])
+}
+
+// Check performs parse time checking on the TernaryNode so it fulfills the Node interface.
+func (n *TernaryNode) Check(t *Tree) error {
+	for _, arg := range []Node{n.Cond, n.Args[0], n.Args[1]} {
+		switch rt := arg.Return(); rt {
+		case TypeNumberSet, TypeSeriesSet, TypeScalar:
+			if err := arg.Check(t); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf(`parse: type error in %s, expected "number", got %s`, n, rt)
+		}
+	}
+	return nil
+}
+
+// Return returns the result type of the TernaryNode so it fulfills the Node interface.
+// It is the greatest type of the condition and the arguments, since a series
+// condition chooses between the arguments at each point.
+func (n *TernaryNode) Return() ReturnType {
+	r := n.Cond.Return()
+	for _, arg := range n.Args {
+		if t := arg.Return(); t > r {
+			r = t
+		}
+	}
+	return r
+}
+
 // Walk invokes f on n and sub-nodes of n.
 func Walk(n Node, f func(Node)) {
 	f(n)
@@ -386,6 +504,10 @@ func Walk(n Node, f func(Node)) {
 		// Ignore since these node types have no sub nodes.
 	case *UnaryNode:
 		Walk(n.Arg, f)
+	case *TernaryNode:
+		Walk(n.Cond, f)
+		Walk(n.Args[0], f)
+		Walk(n.Args[1], f)
 	default:
 		panic(fmt.Errorf("other type: %T", n))
 	}
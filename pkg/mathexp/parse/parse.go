@@ -37,6 +37,18 @@ type Func struct {
 	Check         func(*Tree, *FuncNode) error
 }
 
+// variantArg returns the index of the first TypeVariantSet argument of f. The
+// type of that argument is the return type of a function with VariantReturn.
+// It is 0 if f has no TypeVariantSet argument.
+func (f Func) variantArg() int {
+	for i, arg := range f.Args {
+		if arg == TypeVariantSet {
+			return i
+		}
+	}
+	return 0
+}
+
 // Parse returns a Tree, created by parsing the expression described in the
 // argument string. If an error is encountered, parsing stops and an empty Tree
 // is returned with the error.
@@ -157,7 +169,7 @@ func (t *Tree) Parse(text string, funcs ...map[string]Func) (err error) {
 // parse is the top-level parser for an expression.
 // It runs to EOF.
 func (t *Tree) parse() {
-	t.Root = t.O()
+	t.Root = t.T()
 	t.expect(itemEOF, "root input")
 	if err := t.Root.Check(t); err != nil {
 		t.error(err)
@@ -165,27 +177,122 @@ func (t *Tree) parse() {
 }
 
 /* Grammar:
-O -> A {"||" A}
-A -> C {"&&" C}
-C -> P {( "==" | "!=" | ">" | ">=" | "<" | "<=") P}
-P -> M {( "+" | "-" ) M}
-M -> E {( "*" | "/" ) F}
-E -> F {( "**" ) F}
-F -> v | "(" O ")" | "!" O | "-" O
+T -> N ["?" T ":" T]
+N -> O {"??" [Match] O}
+O -> A {"||" [Match] A}
+A -> C {"&&" [Match] C}
+C -> P {( "==" | "!=" | ">" | ">=" | "<" | "<=") [Match] P}
+P -> M {( "+" | "-" ) [Match] M}
+M -> E {( "*" | "/" ) [Match] F}
+E -> F {( "**" ) [Match] F}
+F -> v | "(" T ")" | "!" O | "-" O
 v -> number | func(..) | queryVar
 Func -> name "(" param {"," param} ")"
-param -> number | "string" | queryVar
+param -> T | "string"
+Match -> ("on" | "ignoring") Labels [("group_left" | "group_right") [Labels]]
+Labels -> "(" [label {"," label}] ")"
 */
 
 // expr:
 
+// binary creates a BinaryNode for the operator op with the left hand side lhs.
+// Any label matching modifiers that follow the operator are parsed before the
+// right hand side is parsed with rhs.
+func (t *Tree) binary(op item, lhs Node, rhs func() Node) Node {
+	matching := t.Match()
+	b := newBinary(op, lhs, rhs())
+	b.Matching = matching
+	return b
+}
+
+// Match is ("on" | "ignoring") Labels [("group_left" | "group_right") [Labels]]
+// in the grammar. It returns nil if there are no label matching modifiers.
+func (t *Tree) Match() *VectorMatching {
+	token := t.peek()
+	if token.typ != itemFunc || (token.val != "on" && token.val != "ignoring") {
+		return nil
+	}
+	t.next()
+	m := &VectorMatching{
+		Card: CardOneToOne,
+		On:   token.val == "on",
+	}
+	m.MatchingLabels = t.Labels(token.val)
+
+	token = t.peek()
+	if token.typ != itemFunc || (token.val != "group_left" && token.val != "group_right") {
+		return m
+	}
+	t.next()
+	m.Card = CardManyToOne
+	if token.val == "group_right" {
+		m.Card = CardOneToMany
+	}
+	if t.peek().typ == itemLeftParen {
+		m.Include = t.Labels(token.val)
+	}
+	return m
+}
+
+// Labels is "(" [label {"," label}] ")" in the grammar.
+func (t *Tree) Labels(context string) []string {
+	labels := []string{}
+	t.expect(itemLeftParen, context)
+	for {
+		switch token := t.next(); token.typ {
+		case itemFunc:
+			labels = append(labels, token.val)
+		case itemRightParen:
+			return labels
+		default:
+			t.unexpected(token, context)
+		}
+		switch token := t.next(); token.typ {
+		case itemComma:
+			// continue
+		case itemRightParen:
+			return labels
+		default:
+			t.unexpected(token, context)
+		}
+	}
+}
+
+// T is N ["?" T ":" T] in the grammar. The conditional operator has the lowest
+// precedence and is right associative, so a ? b : c ? d : e is a ? b : (c ? d : e).
+func (t *Tree) T() Node {
+	n := t.N()
+	if t.peek().typ != itemQuestion {
+		return n
+	}
+	token := t.next()
+	a := t.T()
+	t.expect(itemColon, "input: T()")
+	b := t.T()
+	return newTernary(token.pos, n, a, b)
+}
+
+// N is O {"??" O} in the grammar. The null coalescing operator takes the left
+// operand unless it is null or NaN, in which case it takes the right operand.
+func (t *Tree) N() Node {
+	n := t.O()
+	for {
+		switch t.peek().typ {
+		case itemCoalesce:
+			n = t.binary(t.next(), n, t.O)
+		default:
+			return n
+		}
+	}
+}
+
 // O is A {"||" A} in the grammar.
 func (t *Tree) O() Node {
 	n := t.A()
 	for {
 		switch t.peek().typ {
 		case itemOr:
-			n = newBinary(t.next(), n, t.A())
+			n = t.binary(t.next(), n, t.A)
 		default:
 			return n
 		}
@@ -198,7 +305,7 @@ func (t *Tree) A() Node {
 	for {
 		switch t.peek().typ {
 		case itemAnd:
-			n = newBinary(t.next(), n, t.C())
+			n = t.binary(t.next(), n, t.C)
 		default:
 			return n
 		}
@@ -211,7 +318,7 @@ func (t *Tree) C() Node {
 	for {
 		switch t.peek().typ {
 		case itemEq, itemNotEq, itemGreater, itemGreaterEq, itemLess, itemLessEq:
-			n = newBinary(t.next(), n, t.P())
+			n = t.binary(t.next(), n, t.P)
 		default:
 			return n
 		}
@@ -224,7 +331,7 @@ func (t *Tree) P() Node {
 	for {
 		switch t.peek().typ {
 		case itemPlus, itemMinus:
-			n = newBinary(t.next(), n, t.M())
+			n = t.binary(t.next(), n, t.M)
 		default:
 			return n
 		}
@@ -237,7 +344,7 @@ func (t *Tree) M() Node {
 	for {
 		switch t.peek().typ {
 		case itemMult, itemDiv, itemMod:
-			n = newBinary(t.next(), n, t.E())
+			n = t.binary(t.next(), n, t.E)
 		default:
 			return n
 		}
@@ -250,14 +357,14 @@ func (t *Tree) E() Node {
 	for {
 		switch t.peek().typ {
 		case itemPow:
-			n = newBinary(t.next(), n, t.F())
+			n = t.binary(t.next(), n, t.F)
 		default:
 			return n
 		}
 	}
 }
 
-// F is v | "(" O ")" | "!" O | "-" O in the grammar.
+// F is v | "(" T ")" | "!" O | "-" O in the grammar.
 func (t *Tree) F() Node {
 	switch token := t.peek(); token.typ {
 	case itemNumber, itemFunc, itemVar:
@@ -266,7 +373,7 @@ func (t *Tree) F() Node {
 		return newUnary(t.next(), t.F())
 	case itemLeftParen:
 		t.next()
-		n := t.O()
+		n := t.T()
 		t.expect(itemRightParen, "input: F()")
 		return n
 	default:
@@ -317,9 +424,9 @@ func (t *Tree) Func() (f *FuncNode) {
 		switch token = t.next(); token.typ {
 		default:
 			t.backup()
-			node := t.O()
+			node := t.T()
 			f.append(node)
-			if len(f.Args) == 1 && f.F.VariantReturn {
+			if f.F.VariantReturn && len(f.Args)-1 == f.F.variantArg() {
 				f.F.Return = node.Return()
 			}
 		case itemString:
@@ -331,6 +438,14 @@ func (t *Tree) Func() (f *FuncNode) {
 		case itemRightParen:
 			return
 		}
+		switch token = t.next(); token.typ {
+		case itemComma:
+			// continue
+		case itemRightParen:
+			return
+		default:
+			t.unexpected(token, "input: Func()")
+		}
 	}
 }
 
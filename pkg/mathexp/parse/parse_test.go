@@ -0,0 +1,96 @@
+package parse
+
+import (
+	"testing"
+)
+
+func TestParseVectorMatching(t *testing.T) {
+	var tests = []struct {
+		name   string
+		input  string
+		ok     bool
+		result string
+	}{
+		{"no modifiers", "$A + $B", true, "$A + $B"},
+		{"on", "$A + on(host, env) $B", true, "$A + on(host, env) $B"},
+		{"ignoring", "$A / ignoring(instance) $B", true, "$A / ignoring(instance) $B"},
+		{"empty on", "$A * on() $B", true, "$A * on() $B"},
+		{"group_left with include", "$A * on(host) group_left(region) $B", true, "$A * on(host) group_left(region) $B"},
+		{"group_right without include", "$A > ignoring(cpu) group_right $B", true, "$A > ignoring(cpu) group_right() $B"},
+		{"modifier binds to the nearest operator", "$A + on(host) $B * $C", true, "$A + on(host) $B * $C"},
+		{"missing labels", "$A + on $B", false, ""},
+		{"unclosed labels", "$A + on(host $B", false, ""},
+		{"scalar operand", "$A + on(host) 1", false, ""},
+		{"nested scalar operand", "($A + on(host) 1) * 2", false, ""},
+		{"group_left without on", "$A + group_left $B", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := Parse(tt.input)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("expected error parsing %q, got %v", tt.input, tree.Root)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error parsing %q: %v", tt.input, err)
+			}
+			if s := tree.String(); s != tt.result {
+				t.Errorf("expected %q, got %q", tt.result, s)
+			}
+		})
+	}
+}
+
+func TestParseVectorMatchingFields(t *testing.T) {
+	tree, err := Parse("$A * ignoring(instance, cpu) group_left(region) $B")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, ok := tree.Root.(*BinaryNode)
+	if !ok {
+		t.Fatalf("expected *BinaryNode, got %T", tree.Root)
+	}
+	m := b.Matching
+	if m == nil || m.On || m.Card != CardManyToOne || len(m.MatchingLabels) != 2 || len(m.Include) != 1 || m.Include[0] != "region" {
+		t.Errorf("unexpected vector matching %+v", m)
+	}
+}
+
+func TestParseTernary(t *testing.T) {
+	var tests = []struct {
+		name  string
+		input string
+		ok    bool
+		ast   string
+	}{
+		{"simple", "$A > 0 ? $A : 0", true, "?:($A > 0, $A, 0)"},
+		{"right associative", "$A ? 1 : $B ? 2 : 3", true, "?:($A, 1, $B ? 2 : 3)"},
+		{"nested in the middle", "$A ? $B ? 1 : 2 : 3", true, "?:($A, $B ? 1 : 2, 3)"},
+		{"lowest precedence", "$A || $B ? $C + 1 : -$C", true, "?:($A || $B, $C + 1, -$C)"},
+		{"parenthesized", "($A ? 1 : 2) * 3", true, "*($A ? 1 : 2, 3)"},
+		{"coalesce binds tighter", "$A ?? $B ? $C : 0", true, "?:($A ?? $B, $C, 0)"},
+		{"coalesce in condition", "$A ? $B ?? 1 : 2", true, "?:($A, $B ?? 1, 2)"},
+		{"missing else", "$A ? 1", false, ""},
+		{"missing then", "$A ? : 1", false, ""},
+		{"string argument", `$A ? "a" : 1`, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := Parse(tt.input)
+			if !tt.ok {
+				if err == nil {
+					t.Errorf("expected error parsing %q, got %v", tt.input, tree.Root)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error parsing %q: %v", tt.input, err)
+			}
+			if s := tree.Root.StringAST(); s != tt.ast {
+				t.Errorf("expected %q, got %q", tt.ast, s)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package mathexp
+
+// Rate returns the per-second rate of increase of a counter between each point
+// and the previous point, correcting for counter resets. See Increase.
+func (s Series) Rate() Series {
+	return s.diff(true, true)
+}
+
+// Increase returns the increase of a counter between each point and the previous point.
+// A decrease is treated as a counter reset to zero, so the increase is the value of the point.
+func (s Series) Increase() Series {
+	return s.diff(true, false)
+}
+
+// Delta returns the difference between each point and the previous point.
+func (s Series) Delta() Series {
+	return s.diff(false, false)
+}
+
+// Deriv returns the per-second derivative between each point and the previous point.
+func (s Series) Deriv() Series {
+	return s.diff(false, true)
+}
+
+// diff returns a Series with a point for each point of s after the first. The value
+// is the difference from the previous point, where points are sorted by time and null
+// points are skipped. If counter is true, a decrease is treated as a counter reset and
+// the difference is the value of the point. If perSecond is true, the difference is
+// divided by the seconds between the points, so irregular spacing is accounted for.
+// Points with the same time as the previous point are dropped.
+func (s Series) diff(counter, perSecond bool) Series {
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, s.ValueIsNullabe, 0)
+	var prev *point
+	for _, p := range sortedPoints(s) {
+		p := p
+		if p.f == nil {
+			continue
+		}
+		if prev == nil || !p.t.After(prev.t) {
+			prev = &p
+			continue
+		}
+		d := *p.f - *prev.f
+		if counter && d < 0 {
+			d = *p.f
+		}
+		if perSecond {
+			d /= p.t.Sub(prev.t).Seconds()
+		}
+		newSeries.AppendPoint(newSeries.Len(), &p.t, &d)
+		prev = &p
+	}
+	return newSeries
+}
@@ -0,0 +1,69 @@
+package mathexp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateFuncs(t *testing.T) {
+	counter := Vars{
+		"A": Results{
+			[]Value{
+				makeSeries("", data.Labels{"host": "a"}, tp{
+					time.Unix(0, 0), float64Pointer(10),
+				}, tp{
+					time.Unix(10, 0), float64Pointer(20),
+				}, tp{
+					time.Unix(20, 0), float64Pointer(5),
+				}, tp{
+					time.Unix(30, 0), nil,
+				}, tp{
+					time.Unix(40, 0), float64Pointer(15),
+				}),
+			},
+		},
+	}
+	expected := func(f1, f2, f3 float64) Results {
+		return Results{
+			[]Value{
+				makeSeries("", data.Labels{"host": "a"}, tp{
+					time.Unix(10, 0), float64Pointer(f1),
+				}, tp{
+					time.Unix(20, 0), float64Pointer(f2),
+				}, tp{
+					time.Unix(40, 0), float64Pointer(f3),
+				}),
+			},
+		}
+	}
+	var tests = []struct {
+		name    string
+		expr    string
+		results Results
+	}{
+		{"increase corrects counter resets", "increase($A)", expected(10, 5, 10)},
+		{"rate divides by the seconds between points", "rate($A)", expected(1, 0.5, 0.5)},
+		{"delta does not correct resets", "delta($A)", expected(10, -15, 10)},
+		{"deriv divides by the seconds between points", "deriv($A)", expected(1, -1.5, 0.5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			assert.NoError(t, err)
+			res, err := e.Execute(counter)
+			assert.NoError(t, err)
+			if diff := cmp.Diff(tt.results, res, data.FrameTestCompareOptions()...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRateSinglePoint(t *testing.T) {
+	s := makeSeries("", nil, tp{time.Unix(0, 0), float64Pointer(1)})
+	assert.Equal(t, 0, s.Rate().Len())
+}
@@ -3,6 +3,8 @@ package mathexp
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
@@ -72,30 +74,251 @@ func Count(fv *data.Field) *float64 {
 	return &f
 }
 
+// fieldFloats returns the values of a float64 or *float64 field.
+// hasNull is true if the field has any null values, which are not in vals.
+func fieldFloats(fv *data.Field) (vals []float64, hasNull bool) {
+	vals = make([]float64, 0, fv.Len())
+	for i := 0; i < fv.Len(); i++ {
+		switch v := fv.At(i).(type) {
+		case float64:
+			vals = append(vals, v)
+		case *float64:
+			if v == nil {
+				hasNull = true
+				continue
+			}
+			vals = append(vals, *v)
+		}
+	}
+	return vals, hasNull
+}
+
+// reduceFloats applies f to the values of the field. The result is
+// NaN if the field is empty or has any null values.
+func reduceFloats(fv *data.Field, f func(vals []float64) float64) *float64 {
+	vals, hasNull := fieldFloats(fv)
+	r := math.NaN()
+	if !hasNull && len(vals) > 0 {
+		r = f(vals)
+	}
+	return &r
+}
+
+// CountNonNull returns the number of non-null values.
+func CountNonNull(fv *data.Field) *float64 {
+	vals, _ := fieldFloats(fv)
+	f := float64(len(vals))
+	return &f
+}
+
+// Last returns the last value, or NaN if the field is empty or the last value is null.
+func Last(fv *data.Field) *float64 {
+	return pointAt(fv, fv.Len()-1)
+}
+
+// First returns the first value, or NaN if the field is empty or the first value is null.
+func First(fv *data.Field) *float64 {
+	return pointAt(fv, 0)
+}
+
+func pointAt(fv *data.Field, i int) *float64 {
+	f := math.NaN()
+	if i >= 0 && i < fv.Len() {
+		switch v := fv.At(i).(type) {
+		case float64:
+			f = v
+		case *float64:
+			if v != nil {
+				f = *v
+			}
+		}
+	}
+	return &f
+}
+
+// Median returns the 50th percentile.
+func Median(fv *data.Field) *float64 {
+	return Percentile(fv, 50)
+}
+
+// Percentile returns the pth percentile, where p is between 0 and 100. Values
+// are linearly interpolated between the closest ranks, which is the same method
+// as Excel's PERCENTILE.INC and NumPy's default.
+func Percentile(fv *data.Field, p float64) *float64 {
+	return reduceFloats(fv, func(vals []float64) float64 {
+		return quantileFloats(vals, p/100)
+	})
+}
+
+// StdDev returns the population standard deviation.
+func StdDev(fv *data.Field) *float64 {
+	return reduceFloats(fv, stdDevFloats)
+}
+
+// Variance returns the population variance.
+func Variance(fv *data.Field) *float64 {
+	return reduceFloats(fv, varianceFloats)
+}
+
+// Range returns the difference between the maximum and minimum values.
+func Range(fv *data.Field) *float64 {
+	return reduceFloats(fv, func(vals []float64) float64 {
+		min, max := vals[0], vals[0]
+		for _, v := range vals[1:] {
+			min = math.Min(min, v)
+			max = math.Max(max, v)
+		}
+		return max - min
+	})
+}
+
+// Diff returns the difference between the last and first values.
+func Diff(fv *data.Field) *float64 {
+	f := *Last(fv) - *First(fv)
+	return &f
+}
+
+// parsePercentile returns the percentile of a reducer such as "p95" or "p99.9".
+func parsePercentile(rFunc string) (float64, bool) {
+	if !strings.HasPrefix(rFunc, "p") {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(rFunc[1:], 64)
+	if err != nil || p < 0 || p > 100 {
+		return 0, false
+	}
+	return p, true
+}
+
+// reduceField applies the reduction function rFunc to the values of the field.
+func reduceField(rFunc string, fv *data.Field) (*float64, error) {
+	switch rFunc {
+	case "sum":
+		return Sum(fv), nil
+	case "mean":
+		return Avg(fv), nil
+	case "min":
+		return Min(fv), nil
+	case "max":
+		return Max(fv), nil
+	case "count":
+		return Count(fv), nil
+	case "count_non_null":
+		return CountNonNull(fv), nil
+	case "last":
+		return Last(fv), nil
+	case "first":
+		return First(fv), nil
+	case "median":
+		return Median(fv), nil
+	case "stddev":
+		return StdDev(fv), nil
+	case "variance":
+		return Variance(fv), nil
+	case "range":
+		return Range(fv), nil
+	case "diff":
+		return Diff(fv), nil
+	}
+	if p, ok := parsePercentile(rFunc); ok {
+		return Percentile(fv, p), nil
+	}
+	return nil, fmt.Errorf("reduction %v not implemented", rFunc)
+}
+
 // Reduce turns the Series into a Number based on the given reduction function
 func (s Series) Reduce(rFunc string) (Number, error) {
+	return s.ReduceWithNullMode(rFunc, NullModeDefault)
+}
+
+// ReduceWithNullMode turns the Series into a Number based on the given reduction function,
+// handling null values according to the NullMode. NullModeDefault results in NaN from
+// any null for all reducers except count.
+func (s Series) ReduceWithNullMode(rFunc string, nullMode NullMode) (Number, error) {
 	var l data.Labels
 	if s.GetLabels() != nil {
 		l = s.GetLabels().Copy()
 	}
 	number := NewNumber(fmt.Sprintf("%v_%v", rFunc, s.GetName()), l)
-	var f *float64
 	fVec := s.Frame.Fields[1]
-	switch rFunc {
-	case "sum":
-		f = Sum(fVec)
-	case "mean":
-		f = Avg(fVec)
-	case "min":
-		f = Min(fVec)
-	case "max":
-		f = Max(fVec)
-	case "count":
-		f = Count(fVec)
-	default:
-		return number, fmt.Errorf("reduction %v not implemented", rFunc)
+	if nullMode != NullModeDefault {
+		vals := make([]*float64, s.Len())
+		for i := range vals {
+			_, vals[i] = s.GetPoint(i)
+		}
+		floats, r, ok := nullMode.reduceInputs(vals)
+		if !ok {
+			number.SetValue(r)
+			return number, nil
+		}
+		ptrs := make([]*float64, len(floats))
+		for i := range floats {
+			ptrs[i] = &floats[i]
+		}
+		fVec = data.NewField(fVec.Name, fVec.Labels, ptrs)
+	}
+	f, err := reduceField(rFunc, fVec)
+	if err != nil {
+		return number, err
 	}
 	number.SetValue(f)
 
 	return number, nil
 }
+
+// ReduceMapper changes the points of a Series before it is reduced.
+type ReduceMapper interface {
+	MapInput(s Series) Series
+}
+
+// ParseReduceMapper returns the ReduceMapper for a reduce mode. The mode is one of
+// "strict" (or empty), which reduces the series as is and returns nil, "dropNN",
+// which drops null and NaN values, or "replaceNN", which replaces null and NaN
+// values with replaceWith.
+func ParseReduceMapper(mode string, replaceWith float64) (ReduceMapper, error) {
+	switch mode {
+	case "", "strict":
+		return nil, nil
+	case "dropNN":
+		return DropNonNumber{}, nil
+	case "replaceNN":
+		return ReplaceNonNumberWithValue{Value: replaceWith}, nil
+	default:
+		return nil, fmt.Errorf("reduce mode %v not implemented", mode)
+	}
+}
+
+// DropNonNumber is a ReduceMapper that drops points with null and NaN values.
+type DropNonNumber struct{}
+
+// MapInput returns a new Series without the points that have null or NaN values.
+func (d DropNonNumber) MapInput(s Series) Series {
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, s.ValueIsNullabe, 0)
+	for i := 0; i < s.Len(); i++ {
+		t, f := s.GetPoint(i)
+		if f == nil || math.IsNaN(*f) {
+			continue
+		}
+		newSeries.AppendPoint(i, t, f)
+	}
+	return newSeries
+}
+
+// ReplaceNonNumberWithValue is a ReduceMapper that replaces null and NaN values with Value.
+type ReplaceNonNumberWithValue struct {
+	Value float64
+}
+
+// MapInput returns a new Series with null and NaN values replaced by Value.
+func (r ReplaceNonNumberWithValue) MapInput(s Series) Series {
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, s.ValueIsNullabe, s.Len())
+	for i := 0; i < s.Len(); i++ {
+		t, f := s.GetPoint(i)
+		if f == nil || math.IsNaN(*f) {
+			v := r.Value
+			f = &v
+		}
+		newSeries.SetPoint(i, t, f)
+	}
+	return newSeries
+}
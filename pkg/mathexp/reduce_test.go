@@ -22,6 +22,22 @@ var seriesWithNil = Vars{
 	},
 }
 
+var seriesStats = Vars{
+	"A": Results{
+		[]Value{
+			makeSeries("temp", nil, tp{
+				time.Unix(5, 0), float64Pointer(3),
+			}, tp{
+				time.Unix(10, 0), float64Pointer(1),
+			}, tp{
+				time.Unix(15, 0), float64Pointer(4),
+			}, tp{
+				time.Unix(20, 0), float64Pointer(2),
+			}),
+		},
+	},
+}
+
 var seriesEmpty = Vars{
 	"A": Results{
 		[]Value{
@@ -191,6 +207,208 @@ func TestSeriesReduce(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:        "last series",
+			red:         "last",
+			varToReduce: "A",
+			vars:        seriesStats,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("last_", nil, float64Pointer(2)),
+				},
+			},
+		},
+		{
+			name:        "first series",
+			red:         "first",
+			varToReduce: "A",
+			vars:        seriesStats,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("first_", nil, float64Pointer(3)),
+				},
+			},
+		},
+		{
+			name:        "median series",
+			red:         "median",
+			varToReduce: "A",
+			vars:        seriesStats,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("median_", nil, float64Pointer(2.5)),
+				},
+			},
+		},
+		{
+			name:        "stddev series",
+			red:         "stddev",
+			varToReduce: "A",
+			vars:        seriesStats,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("stddev_", nil, float64Pointer(math.Sqrt(1.25))),
+				},
+			},
+		},
+		{
+			name:        "variance series",
+			red:         "variance",
+			varToReduce: "A",
+			vars:        seriesStats,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("variance_", nil, float64Pointer(1.25)),
+				},
+			},
+		},
+		{
+			name:        "p75 series interpolates between closest ranks",
+			red:         "p75",
+			varToReduce: "A",
+			vars:        seriesStats,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("p75_", nil, float64Pointer(3.25)),
+				},
+			},
+		},
+		{
+			name:        "p0 series is the min",
+			red:         "p0",
+			varToReduce: "A",
+			vars:        seriesStats,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("p0_", nil, float64Pointer(1)),
+				},
+			},
+		},
+		{
+			name:        "range series",
+			red:         "range",
+			varToReduce: "A",
+			vars:        seriesStats,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("range_", nil, float64Pointer(3)),
+				},
+			},
+		},
+		{
+			name:        "range non-nullable series",
+			red:         "range",
+			varToReduce: "A",
+			vars: Vars{
+				"A": Results{
+					[]Value{
+						makeNoNullSeries("temp", nil, noNullTP{
+							time.Unix(5, 0), 3,
+						}, noNullTP{
+							time.Unix(10, 0), 1,
+						}, noNullTP{
+							time.Unix(15, 0), 4,
+						}),
+					},
+				},
+			},
+			errIs:     require.NoError,
+			resultsIs: require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("range_", nil, float64Pointer(3)),
+				},
+			},
+		},
+		{
+			name:        "diff series",
+			red:         "diff",
+			varToReduce: "A",
+			vars:        seriesStats,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("diff_", nil, float64Pointer(-1)),
+				},
+			},
+		},
+		{
+			name:        "count_non_null series with a nil value",
+			red:         "count_non_null",
+			varToReduce: "A",
+			vars:        seriesWithNil,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("count_non_null_", nil, float64Pointer(1)),
+				},
+			},
+		},
+		{
+			name:        "last series with a nil value",
+			red:         "last",
+			varToReduce: "A",
+			vars:        seriesWithNil,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("last_", nil, NaN),
+				},
+			},
+		},
+		{
+			name:        "median series with a nil value",
+			red:         "median",
+			varToReduce: "A",
+			vars:        seriesWithNil,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("median_", nil, NaN),
+				},
+			},
+		},
+		{
+			name:        "median empty series",
+			red:         "median",
+			varToReduce: "A",
+			vars:        seriesEmpty,
+			errIs:       require.NoError,
+			resultsIs:   require.Equal,
+			results: Results{
+				[]Value{
+					makeNumber("median_", nil, NaN),
+				},
+			},
+		},
+		{
+			name:        "p101 reduction will error",
+			red:         "p101",
+			varToReduce: "A",
+			vars:        seriesStats,
+			errIs:       require.Error,
+			resultsIs:   require.Equal,
+		},
 		{
 			name:        "mean series with labels",
 			red:         "mean",
@@ -238,3 +456,51 @@ func TestSeriesReduce(t *testing.T) {
 		})
 	}
 }
+
+func TestReduceMapper(t *testing.T) {
+	s := makeSeries("temp", nil, tp{
+		time.Unix(5, 0), float64Pointer(2),
+	}, tp{
+		time.Unix(10, 0), nil,
+	}, tp{
+		time.Unix(15, 0), NaN,
+	}, tp{
+		time.Unix(20, 0), float64Pointer(4),
+	})
+	var tests = []struct {
+		mode    string
+		sum     *float64
+		mean    *float64
+		count   *float64
+		errIs   require.ErrorAssertionFunc
+		replace float64
+	}{
+		{mode: "strict", sum: NaN, mean: NaN, count: float64Pointer(4), errIs: require.NoError},
+		{mode: "dropNN", sum: float64Pointer(6), mean: float64Pointer(3), count: float64Pointer(2), errIs: require.NoError},
+		{mode: "replaceNN", replace: 1, sum: float64Pointer(8), mean: float64Pointer(2), count: float64Pointer(4), errIs: require.NoError},
+		{mode: "foo", errIs: require.Error},
+	}
+	opt := cmp.Comparer(func(x, y float64) bool {
+		return (math.IsNaN(x) && math.IsNaN(y)) || x == y
+	})
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			mapper, err := ParseReduceMapper(tt.mode, tt.replace)
+			tt.errIs(t, err)
+			if err != nil {
+				return
+			}
+			mapped := s
+			if mapper != nil {
+				mapped = mapper.MapInput(s)
+			}
+			for red, want := range map[string]*float64{"sum": tt.sum, "mean": tt.mean, "count": tt.count} {
+				n, err := mapped.Reduce(red)
+				require.NoError(t, err)
+				if diff := cmp.Diff(want, n.GetFloat64Value(), opt); diff != "" {
+					t.Errorf("%v mismatch (-want +got):\n%s", red, diff)
+				}
+			}
+		})
+	}
+}
@@ -30,7 +30,8 @@ var aliasToDuration = map[string]time.Duration{
 
 var re *regexp.Regexp
 
-func parseRule(rule string) (time.Duration, error) {
+// parseRule splits a rule such as "5min" into its multiplier and alias.
+func parseRule(rule string) (int64, string, error) {
 	if re == nil {
 		// run only once
 		aliases := make([]string, 0)
@@ -42,42 +43,201 @@ func parseRule(rule string) (time.Duration, error) {
 	}
 	match := re.FindStringSubmatch(rule)
 
-	errDuration, _ := time.ParseDuration("0s")
 	if len(match) == 0 {
-		// What should I return instead of s?
-		return errDuration, fmt.Errorf("resample rule %v not implemented", rule)
+		return 0, "", fmt.Errorf("resample rule %v not implemented", rule)
 	}
 	var multiplier int64
 	if match[1] != "" {
 		valueInt64, err := strconv.ParseInt(match[1], 10, 64)
 		if err != nil {
 			// Different message for ErrSyntax and ErrRange
-			return errDuration, fmt.Errorf("string %v cannot be converted to integer", match[1])
+			return 0, "", fmt.Errorf("string %v cannot be converted to integer", match[1])
 		}
 		multiplier = valueInt64
 	} else {
 		multiplier = 1
 	}
-	return time.Duration(multiplier) * aliasToDuration[match[2]], nil
+	return multiplier, match[2], nil
 }
 
-// Resample turns the Series into a Number based on the given reduction function
+// cleanIntervals are the interval widths AutoRule rounds up to.
+var cleanIntervals = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 20 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 200 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 15 * time.Second, 30 * time.Second,
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+// AutoRule returns a resample rule whose interval gives at most maxDataPoints points
+// over the time range, but is no smaller than minInterval. The interval is rounded up
+// to a clean duration such as 10S, 5T or 1H, like Grafana's $__interval.
+// A maxDataPoints of zero or less means there is no limit on the number of points.
+func AutoRule(tr backend.TimeRange, minInterval time.Duration, maxDataPoints int64) string {
+	width := minInterval
+	if maxDataPoints > 0 {
+		if w := tr.To.Sub(tr.From) / time.Duration(maxDataPoints); w > width {
+			width = w
+		}
+	}
+	interval := cleanIntervals[len(cleanIntervals)-1]
+	if width > interval {
+		// Larger than a week, round up to whole days.
+		days := (width + 24*time.Hour - 1) / (24 * time.Hour)
+		return fmt.Sprintf("%vD", int64(days))
+	}
+	for _, c := range cleanIntervals {
+		if c >= width {
+			interval = c
+			break
+		}
+	}
+	return durationToRule(interval)
+}
+
+// durationToRule returns a rule for d with the largest alias that divides it exactly.
+func durationToRule(d time.Duration) string {
+	for _, alias := range []string{"D", "H", "T", "S"} {
+		if unit := aliasToDuration[alias]; d%unit == 0 {
+			return fmt.Sprintf("%v%v", int64(d/unit), alias)
+		}
+	}
+	return fmt.Sprintf("%vL", int64(d/time.Millisecond))
+}
+
+// ResampleOptions change where the points of a resampled series are placed in time.
+type ResampleOptions struct {
+	// Align places the points on the wall clock boundaries of the rule's unit in
+	// Location, such as the start of the minute, hour, day, week (Monday) or month,
+	// instead of at the start of the time range. Days, weeks, months and years are
+	// calendar units, so a day is not always 24 hours and a month is a true month.
+	// Each point is the bucket that starts at its time and ends at the next point,
+	// so the point of January 1st has the values of January.
+	Align bool
+	// Location is the timezone used when Align is true. If nil, UTC is used.
+	Location *time.Location
+}
+
+// truncateToUnit returns the start of the unit of the rule alias that contains t,
+// in the location of t.
+func truncateToUnit(t time.Time, alias string) time.Time {
+	y, m, d := t.Date()
+	loc := t.Location()
+	switch alias {
+	case "Y":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	case "MS":
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	case "W":
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-daysSinceMonday, 0, 0, 0, 0, loc)
+	case "D":
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	case "H":
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, loc)
+	default:
+		return t.Truncate(aliasToDuration[alias])
+	}
+}
+
+// addUnits adds n units of the rule alias to t, using calendar days, weeks,
+// months and years.
+func addUnits(t time.Time, n int64, alias string) time.Time {
+	switch alias {
+	case "Y":
+		return t.AddDate(int(n), 0, 0)
+	case "MS":
+		return t.AddDate(0, int(n), 0)
+	case "W":
+		return t.AddDate(0, 0, 7*int(n))
+	case "D":
+		return t.AddDate(0, 0, int(n))
+	default:
+		return t.Add(time.Duration(n) * aliasToDuration[alias])
+	}
+}
+
+// resampleTimes returns the times of the points of a series resampled by the
+// multiplier and alias of a rule.
+func resampleTimes(multiplier int64, alias string, tr backend.TimeRange, opts ResampleOptions) ([]time.Time, error) {
+	if !opts.Align {
+		interval := time.Duration(multiplier) * aliasToDuration[alias]
+		newSeriesLength := int(float64(tr.To.Sub(tr.From).Nanoseconds()) / float64(interval.Nanoseconds()))
+		if newSeriesLength <= 0 {
+			return nil, fmt.Errorf("The series cannot be sampled further; the time range is shorter than the interval")
+		}
+		times := make([]time.Time, 0, newSeriesLength+1)
+		for t := tr.From; !t.After(tr.To) && len(times) <= newSeriesLength; t = t.Add(interval) {
+			times = append(times, t)
+		}
+		return times, nil
+	}
+
+	if multiplier <= 0 {
+		return nil, fmt.Errorf("resample rule %v%v must have a positive multiplier", multiplier, alias)
+	}
+	if tr.To.Before(tr.From) {
+		return nil, fmt.Errorf("The series cannot be sampled; the time range ends before it starts")
+	}
+	loc := opts.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	var times []time.Time
+	for t := truncateToUnit(tr.From.In(loc), alias); !t.After(tr.To); t = addUnits(t, multiplier, alias) {
+		times = append(times, t)
+	}
+	return times, nil
+}
+
+// Resample turns the Series into a new Series with a point every interval of the rule
+// within the time range. Intervals with points are downsampled with the downsampler,
+// which can be any reduction function of Reduce. Intervals without points are upsampled
+// with the upsampler, which is one of "pad", "backfilling", "fillna", "linear" or "nearest".
+// "linear" interpolates between the points either side of the time, and "nearest" takes
+// the point nearest in time, preferring the earlier point on a tie.
 func (s Series) Resample(rule string, downsampler string, upsampler string, tr backend.TimeRange) (Series, error) {
-	interval, err := parseRule(rule)
+	return s.ResampleWithOptions(rule, downsampler, upsampler, tr, ResampleOptions{})
+}
+
+// ResampleWithOptions is like Resample, but the times of the points are placed
+// according to the ResampleOptions.
+func (s Series) ResampleWithOptions(rule string, downsampler string, upsampler string, tr backend.TimeRange, opts ResampleOptions) (Series, error) {
+	multiplier, alias, err := parseRule(rule)
 	if err != nil {
 		return s, fmt.Errorf(`failed to parse "rule" field %q: %w`, rule, err)
 	}
+	times, err := resampleTimes(multiplier, alias, tr, opts)
+	if err != nil {
+		return s, err
+	}
 
-	newSeriesLength := int(float64(tr.To.Sub(tr.From).Nanoseconds()) / float64(interval.Nanoseconds()))
-	if newSeriesLength <= 0 {
-		return s, fmt.Errorf("The series cannot be sampled further; the time range is shorter than the interval")
+	// inBucket returns true if a point at st is in the bucket of the point at times[idx].
+	// Aligned buckets are [times[idx], times[idx+1]), and other buckets end at times[idx].
+	inBucket := func(st *time.Time, idx int) bool {
+		if !opts.Align {
+			return !st.After(times[idx])
+		}
+		return st.Before(addUnits(times[idx], multiplier, alias))
 	}
-	resampled := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, s.ValueIsNullabe, newSeriesLength+1)
+
+	resampled := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, s.ValueIsNullabe, len(times))
 	bookmark := 0
 	var lastSeen *float64
-	idx := 0
-	t := tr.From
-	for !t.After(tr.To) && idx <= newSeriesLength {
+	var lastSeenTime *time.Time
+	if opts.Align {
+		// Points before the first bucket are not in any bucket, but are seen for upsampling.
+		for ; bookmark < s.Len(); bookmark++ {
+			st, v := s.GetPoint(bookmark)
+			if !st.Before(times[0]) {
+				break
+			}
+			lastSeen, lastSeenTime = v, st
+		}
+	}
+	for idx, t := range times {
 		vals := make([]*float64, 0)
 		sIdx := bookmark
 		for {
@@ -85,12 +245,13 @@ func (s Series) Resample(rule string, downsampler string, upsampler string, tr b
 				break
 			}
 			st, v := s.GetPoint(sIdx)
-			if st.After(t) {
+			if !inBucket(st, idx) {
 				break
 			}
 			bookmark++
 			sIdx++
 			lastSeen = v
+			lastSeenTime = st
 			vals = append(vals, v)
 		}
 		var value *float64
@@ -110,30 +271,36 @@ func (s Series) Resample(rule string, downsampler string, upsampler string, tr b
 				}
 			case "fillna":
 				value = nil
+			case "linear":
+				if lastSeenTime != nil && lastSeen != nil && sIdx < s.Len() {
+					nextTime, next := s.GetPoint(sIdx)
+					if next != nil {
+						ratio := float64(t.Sub(*lastSeenTime)) / float64(nextTime.Sub(*lastSeenTime))
+						f := *lastSeen + ratio*(*next-*lastSeen)
+						value = &f
+					}
+				}
+			case "nearest":
+				if lastSeenTime != nil {
+					value = lastSeen
+				}
+				if sIdx < s.Len() {
+					nextTime, next := s.GetPoint(sIdx)
+					if lastSeenTime == nil || nextTime.Sub(t) < t.Sub(*lastSeenTime) {
+						value = next
+					}
+				}
 			default:
 				return s, fmt.Errorf("Upsampling %v not implemented", upsampler)
 			}
 		} else { // downsampling
 			fVec := data.NewField("", s.GetLabels(), vals)
-			var tmp *float64
-			switch downsampler {
-			case "sum":
-				tmp = Sum(fVec)
-			case "mean":
-				tmp = Avg(fVec)
-			case "min":
-				tmp = Min(fVec)
-			case "max":
-				tmp = Max(fVec)
-			default:
+			if value, err = reduceField(downsampler, fVec); err != nil {
 				return s, fmt.Errorf("Downsampling %v not implemented", downsampler)
 			}
-			value = tmp
 		}
 		tv := t // his is required otherwise all points keep the latest timestamp; anything better?
 		resampled.SetPoint(idx, &tv, value)
-		t = t.Add(interval)
-		idx++
 	}
 	return resampled, nil
 }
@@ -245,6 +245,103 @@ func TestResampleSeries(t *testing.T) {
 				unixTimePointer(10, 0), nil,
 			}),
 		},
+		{
+			name:        "resample series: downsampling (last / fillna)",
+			interval:    "5S",
+			downsampler: "last",
+			upsampler:   "fillna",
+			timeRange: backend.TimeRange{
+				From: time.Unix(0, 0),
+				To:   time.Unix(16, 0),
+			},
+			seriesToResample: makeSeriesNullableTime("", nil, nullTimeTP{
+				unixTimePointer(2, 0), float64Pointer(2),
+			}, nullTimeTP{
+				unixTimePointer(4, 0), float64Pointer(3),
+			}, nullTimeTP{
+				unixTimePointer(7, 0), float64Pointer(1),
+			}, nullTimeTP{
+				unixTimePointer(9, 0), float64Pointer(2),
+			}),
+			series: makeSeriesNullableTime("", nil, nullTimeTP{
+				unixTimePointer(0, 0), nil,
+			}, nullTimeTP{
+				unixTimePointer(5, 0), float64Pointer(3),
+			}, nullTimeTP{
+				unixTimePointer(10, 0), float64Pointer(2),
+			}, nullTimeTP{
+				unixTimePointer(15, 0), nil,
+			}),
+		},
+		{
+			name:        "resample series: upsampling (mean / linear )",
+			interval:    "2S",
+			downsampler: "mean",
+			upsampler:   "linear",
+			timeRange: backend.TimeRange{
+				From: time.Unix(0, 0),
+				To:   time.Unix(11, 0),
+			},
+			seriesToResample: makeSeriesNullableTime("", nil, nullTimeTP{
+				unixTimePointer(2, 0), float64Pointer(2),
+			}, nullTimeTP{
+				unixTimePointer(10, 0), float64Pointer(6),
+			}),
+			series: makeSeriesNullableTime("", nil, nullTimeTP{
+				unixTimePointer(0, 0), nil,
+			}, nullTimeTP{
+				unixTimePointer(2, 0), float64Pointer(2),
+			}, nullTimeTP{
+				unixTimePointer(4, 0), float64Pointer(3),
+			}, nullTimeTP{
+				unixTimePointer(6, 0), float64Pointer(4),
+			}, nullTimeTP{
+				unixTimePointer(8, 0), float64Pointer(5),
+			}, nullTimeTP{
+				unixTimePointer(10, 0), float64Pointer(6),
+			}),
+		},
+		{
+			name:        "resample series: upsampling (mean / nearest )",
+			interval:    "2S",
+			downsampler: "mean",
+			upsampler:   "nearest",
+			timeRange: backend.TimeRange{
+				From: time.Unix(0, 0),
+				To:   time.Unix(11, 0),
+			},
+			seriesToResample: makeSeriesNullableTime("", nil, nullTimeTP{
+				unixTimePointer(2, 0), float64Pointer(2),
+			}, nullTimeTP{
+				unixTimePointer(10, 0), float64Pointer(6),
+			}),
+			series: makeSeriesNullableTime("", nil, nullTimeTP{
+				unixTimePointer(0, 0), float64Pointer(2),
+			}, nullTimeTP{
+				unixTimePointer(2, 0), float64Pointer(2),
+			}, nullTimeTP{
+				unixTimePointer(4, 0), float64Pointer(2),
+			}, nullTimeTP{
+				unixTimePointer(6, 0), float64Pointer(2),
+			}, nullTimeTP{
+				unixTimePointer(8, 0), float64Pointer(6),
+			}, nullTimeTP{
+				unixTimePointer(10, 0), float64Pointer(6),
+			}),
+		},
+		{
+			name:        "resample series: unknown downsampler",
+			interval:    "5S",
+			downsampler: "foo",
+			upsampler:   "fillna",
+			timeRange: backend.TimeRange{
+				From: time.Unix(0, 0),
+				To:   time.Unix(16, 0),
+			},
+			seriesToResample: makeSeriesNullableTime("", nil, nullTimeTP{
+				unixTimePointer(2, 0), float64Pointer(2),
+			}),
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -258,3 +355,173 @@ func TestResampleSeries(t *testing.T) {
 		})
 	}
 }
+
+func TestResampleSeriesAligned(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	eet := time.FixedZone("EET", 2*60*60)
+	var tests = []struct {
+		name             string
+		interval         string
+		opts             ResampleOptions
+		timeRange        backend.TimeRange
+		seriesToResample Series
+		series           Series
+	}{
+		{
+			name:     "calendar months",
+			interval: "MS",
+			opts:     ResampleOptions{Align: true},
+			timeRange: backend.TimeRange{
+				From: time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2020, 4, 10, 0, 0, 0, 0, time.UTC),
+			},
+			seriesToResample: makeSeries("", nil, tp{
+				time.Date(2020, 1, 20, 0, 0, 0, 0, time.UTC), float64Pointer(1),
+			}, tp{
+				time.Date(2020, 2, 10, 0, 0, 0, 0, time.UTC), float64Pointer(2),
+			}, tp{
+				time.Date(2020, 2, 20, 0, 0, 0, 0, time.UTC), float64Pointer(3),
+			}, tp{
+				time.Date(2020, 3, 31, 0, 0, 0, 0, time.UTC), float64Pointer(4),
+			}),
+			series: makeSeries("", nil, tp{
+				time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), float64Pointer(1),
+			}, tp{
+				time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), float64Pointer(5),
+			}, tp{
+				time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), float64Pointer(4),
+			}, tp{
+				time.Date(2020, 4, 1, 0, 0, 0, 0, time.UTC), nil,
+			}),
+		},
+		{
+			name:     "days in a timezone",
+			interval: "D",
+			opts:     ResampleOptions{Align: true, Location: eet},
+			timeRange: backend.TimeRange{
+				From: time.Date(2020, 1, 1, 5, 0, 0, 0, time.UTC),
+				To:   time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC),
+			},
+			seriesToResample: makeSeries("", nil, tp{
+				time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC), float64Pointer(1),
+			}, tp{
+				time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC), float64Pointer(2),
+			}, tp{
+				time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC), float64Pointer(3),
+			}),
+			series: makeSeries("", nil, tp{
+				time.Date(2020, 1, 1, 0, 0, 0, 0, eet), float64Pointer(1),
+			}, tp{
+				time.Date(2020, 1, 2, 0, 0, 0, 0, eet), float64Pointer(5),
+			}, tp{
+				time.Date(2020, 1, 3, 0, 0, 0, 0, eet), nil,
+			}),
+		},
+		{
+			name:     "days across a daylight saving time change",
+			interval: "D",
+			opts:     ResampleOptions{Align: true, Location: newYork},
+			timeRange: backend.TimeRange{
+				From: time.Date(2020, 3, 7, 12, 0, 0, 0, newYork),
+				To:   time.Date(2020, 3, 9, 12, 0, 0, 0, newYork),
+			},
+			seriesToResample: makeSeries("", nil, tp{
+				time.Date(2020, 3, 8, 12, 0, 0, 0, time.UTC), float64Pointer(1),
+			}),
+			series: makeSeries("", nil, tp{
+				time.Date(2020, 3, 7, 0, 0, 0, 0, newYork), nil,
+			}, tp{
+				time.Date(2020, 3, 8, 0, 0, 0, 0, newYork), float64Pointer(1),
+			}, tp{
+				time.Date(2020, 3, 9, 0, 0, 0, 0, newYork), nil,
+			}),
+		},
+		{
+			name:     "weeks start on monday",
+			interval: "W",
+			opts:     ResampleOptions{Align: true},
+			timeRange: backend.TimeRange{
+				From: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), // a wednesday
+				To:   time.Date(2020, 1, 10, 0, 0, 0, 0, time.UTC),
+			},
+			seriesToResample: makeSeries("", nil, tp{
+				time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), float64Pointer(1),
+			}),
+			series: makeSeries("", nil, tp{
+				time.Date(2019, 12, 30, 0, 0, 0, 0, time.UTC), float64Pointer(1),
+			}, tp{
+				time.Date(2020, 1, 6, 0, 0, 0, 0, time.UTC), nil,
+			}),
+		},
+		{
+			name:     "points on a boundary start the bucket",
+			interval: "D",
+			opts:     ResampleOptions{Align: true},
+			timeRange: backend.TimeRange{
+				From: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC),
+				To:   time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC),
+			},
+			seriesToResample: makeSeries("", nil, tp{
+				time.Date(2019, 12, 31, 23, 0, 0, 0, time.UTC), float64Pointer(1),
+			}, tp{
+				time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), float64Pointer(2),
+			}, tp{
+				time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), float64Pointer(3),
+			}),
+			series: makeSeries("", nil, tp{
+				time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), float64Pointer(2),
+			}, tp{
+				time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), float64Pointer(3),
+			}),
+		},
+		{
+			name:     "invalid time range",
+			interval: "D",
+			opts:     ResampleOptions{Align: true},
+			timeRange: backend.TimeRange{
+				From: time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+				To:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			seriesToResample: makeSeries("", nil),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series, err := tt.seriesToResample.ResampleWithOptions(tt.interval, "sum", "fillna", tt.timeRange, tt.opts)
+			if tt.series.Frame == nil {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.series, series)
+			}
+		})
+	}
+}
+
+func TestAutoRule(t *testing.T) {
+	hour := backend.TimeRange{From: time.Unix(0, 0), To: time.Unix(3600, 0)}
+	var tests = []struct {
+		name          string
+		timeRange     backend.TimeRange
+		minInterval   time.Duration
+		maxDataPoints int64
+		rule          string
+	}{
+		{"rounds up to a clean interval", hour, time.Millisecond, 1000, "5S"},
+		{"exact clean interval", hour, time.Millisecond, 360, "10S"},
+		{"min interval is larger", hour, 40 * time.Second, 1000, "1T"},
+		{"no max data points uses the min interval", hour, 15 * time.Second, 0, "15S"},
+		{"sub second interval", hour, time.Millisecond, 10000, "500L"},
+		{"hours", backend.TimeRange{From: time.Unix(0, 0), To: time.Unix(7*86400, 0)}, time.Millisecond, 100, "2H"},
+		{"larger than a week rounds to days", backend.TimeRange{From: time.Unix(0, 0), To: time.Unix(365*86400, 0)}, time.Millisecond, 10, "37D"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := AutoRule(tt.timeRange, tt.minInterval, tt.maxDataPoints)
+			assert.Equal(t, tt.rule, rule)
+			_, _, err := parseRule(rule)
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package mathexp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/gel-app/pkg/mathexp/parse"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// walkTernary evaluates cond ? a : b. The values of a and b are matched by their
+// labels as in a binary operation, and each pair is matched with the values of the
+// condition the same way. For each match the result chooses between a and b at each
+// point, see ternaryValue. The pairs of a and b that do not match, and the pairs of
+// the condition and a pair of a and b where either is left without any match, are
+// recorded as DroppedUnions.
+func (e *State) walkTernary(node *parse.TernaryNode) (Results, error) {
+	res := Results{Values{}}
+	cr, err := e.walk(node.Cond)
+	if err != nil {
+		return res, err
+	}
+	ar, err := e.walk(node.Args[0])
+	if err != nil {
+		return res, err
+	}
+	br, err := e.walk(node.Args[1])
+	if err != nil {
+		return res, err
+	}
+	unions, dropped := union(ar, br)
+	condMatched := make(map[string]bool, len(cr.Values))
+	unionMatched := make([]bool, len(unions))
+	condDropped := make([][]DroppedUnion, len(unions))
+	for i, abUnion := range unions {
+		// The placeholder matches the values of the condition to the labels of the union.
+		placeholder := Results{[]Value{NewNumber("", abUnion.Labels)}}
+		condUnions, d := union(cr, placeholder)
+		condDropped[i] = d
+		for _, condUnion := range condUnions {
+			condMatched[condUnion.A.GetLabels().String()] = true
+			unionMatched[i] = true
+			value, err := ternaryValue(condUnion.Labels, condUnion.A, abUnion.A, abUnion.B, e.NullMode)
+			if err != nil {
+				return res, err
+			}
+			res.Values = append(res.Values, value)
+		}
+	}
+	// Values of the condition that do not match a union may match another one, so
+	// they are only dropped if they match none.
+	for i, ds := range condDropped {
+		for _, d := range ds {
+			if !unionMatched[i] || !condMatched[d.ALabels.String()] {
+				dropped = append(dropped, d)
+			}
+		}
+	}
+	for _, d := range dropped {
+		d.Expr = node.String()
+		e.DroppedUnions = append(e.DroppedUnions, d)
+	}
+	return res, nil
+}
+
+// ternaryValue returns a value with a point for each point of cond, a and b, where
+// the value is a if cond is non-zero and b if cond is zero, see NullMode.ternaryOp.
+//
+// The value is a Series if any of cond, a or b is a Series, and has the times that all
+// of the Series have. Otherwise it is a Number if any of them is a Number, or else a Scalar.
+func ternaryValue(labels data.Labels, cond, a, b Value, nullMode NullMode) (Value, error) {
+	operands := []Value{cond, a, b}
+	values := make([]func(t time.Time) (*float64, bool), len(operands))
+	var first *Series
+	hasNumber := false
+	for i, v := range operands {
+		switch v := v.(type) {
+		case Series:
+			if first == nil {
+				first = &v
+			}
+			values[i] = seriesValues(v)
+		case Number:
+			hasNumber = true
+			f := v.GetFloat64Value()
+			values[i] = func(time.Time) (*float64, bool) { return f, true }
+		case Scalar:
+			f := v.GetFloat64Value()
+			values[i] = func(time.Time) (*float64, bool) { return f, true }
+		default:
+			return nil, fmt.Errorf("not implemented: ternary on %T", v)
+		}
+	}
+	// choose returns the value at t, and false if there is no point at t.
+	choose := func(t time.Time) (*float64, bool) {
+		c, cok := values[0](t)
+		af, aok := values[1](t)
+		bf, bok := values[2](t)
+		if !cok || !aok || !bok {
+			return nil, false
+		}
+		f, skip := nullMode.ternaryOp(c, af, bf)
+		return f, !skip
+	}
+
+	name := labels.String()
+	if first == nil {
+		f, _ := choose(time.Time{})
+		if !hasNumber {
+			return NewScalar(f), nil
+		}
+		newNumber := NewNumber(name, labels)
+		newNumber.SetValue(f)
+		return newNumber, nil
+	}
+	newSeries := NewSeries(name, labels, first.TimeIdx, first.TimeIsNullable, first.ValueIdx, true, 0)
+	for _, p := range sortedPoints(*first) {
+		p := p
+		if f, ok := choose(p.t); ok {
+			if err := newSeries.AppendPoint(newSeries.Len(), &p.t, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return newSeries, nil
+}
+
+// seriesValues returns a function that gives the value of s at a time, and false if
+// s has no point at that time.
+func seriesValues(s Series) func(t time.Time) (*float64, bool) {
+	points := make(map[time.Time]*float64, s.Len())
+	for _, p := range sortedPoints(s) {
+		if _, ok := points[p.t]; !ok {
+			points[p.t] = p.f
+		}
+	}
+	return func(t time.Time) (*float64, bool) {
+		f, ok := points[t]
+		return f, ok
+	}
+}
@@ -0,0 +1,216 @@
+package mathexp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTernary(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeSeries("", nil, tp{
+					time.Unix(0, 0), float64Pointer(-1),
+				}, tp{
+					time.Unix(1, 0), nil,
+				}, tp{
+					time.Unix(2, 0), float64Pointer(3),
+				}, tp{
+					time.Unix(3, 0), NaN,
+				}),
+			},
+		},
+		"B": Results{
+			[]Value{
+				makeSeries("", nil, tp{
+					time.Unix(1, 0), float64Pointer(10),
+				}, tp{
+					time.Unix(2, 0), float64Pointer(20),
+				}, tp{
+					time.Unix(4, 0), float64Pointer(40),
+				}),
+			},
+		},
+		"Up": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "a"}, float64Pointer(1)),
+				makeNumber("", data.Labels{"host": "b"}, float64Pointer(0)),
+			},
+		},
+		"Load": Results{
+			[]Value{
+				makeSeries("", data.Labels{"host": "a"}, tp{
+					time.Unix(0, 0), float64Pointer(5),
+				}),
+				makeSeries("", data.Labels{"host": "b"}, tp{
+					time.Unix(0, 0), float64Pointer(6),
+				}),
+			},
+		},
+	}
+	var tests = []struct {
+		name     string
+		expr     string
+		nullMode NullMode
+		results  Results
+	}{
+		{
+			name:    "scalar condition chooses the first argument",
+			expr:    "1 ? 2 : 3",
+			results: Results{[]Value{NewScalar(float64Pointer(2))}},
+		},
+		{
+			name:    "scalar condition chooses the second argument",
+			expr:    "0 ? 2 : 3",
+			results: Results{[]Value{NewScalar(float64Pointer(3))}},
+		},
+		{
+			name: "series condition chooses per point, null and NaN conditions are kept",
+			expr: "$A > 0 ? $A : 0",
+			results: Results{[]Value{makeSeries("", nil, tp{
+				time.Unix(0, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(1, 0), nil,
+			}, tp{
+				time.Unix(2, 0), float64Pointer(3),
+			}, tp{
+				time.Unix(3, 0), NaN,
+			})}},
+		},
+		{
+			name:     "null conditions are skipped with the skip null mode",
+			expr:     "$A > 0 ? $A : 0",
+			nullMode: NullModeSkip,
+			results: Results{[]Value{makeSeries("", nil, tp{
+				time.Unix(0, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(2, 0), float64Pointer(3),
+			}, tp{
+				time.Unix(3, 0), NaN,
+			})}},
+		},
+		{
+			name:     "null conditions are false with the zero null mode",
+			expr:     "$A > 0 ? $A : 0",
+			nullMode: NullModeZero,
+			results: Results{[]Value{makeSeries("", nil, tp{
+				time.Unix(0, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(1, 0), float64Pointer(0),
+			}, tp{
+				time.Unix(2, 0), float64Pointer(3),
+			}, tp{
+				time.Unix(3, 0), NaN,
+			})}},
+		},
+		{
+			name:     "chosen null values are NaN with the nan null mode",
+			expr:     "$B < 20 ? $A : $B",
+			nullMode: NullModeNaN,
+			results: Results{[]Value{makeSeries("", nil, tp{
+				time.Unix(1, 0), NaN,
+			}, tp{
+				time.Unix(2, 0), float64Pointer(20),
+			})}},
+		},
+		{
+			name: "nested conditions",
+			expr: "$A > 2 ? 2 : $A < 0 ? -2 : $A",
+			results: Results{[]Value{makeSeries("", nil, tp{
+				time.Unix(0, 0), float64Pointer(-2),
+			}, tp{
+				time.Unix(1, 0), nil,
+			}, tp{
+				time.Unix(2, 0), float64Pointer(2),
+			}, tp{
+				time.Unix(3, 0), NaN,
+			})}},
+		},
+		{
+			name: "series have the times common to all series",
+			expr: "$A ? $B : -1",
+			results: Results{[]Value{makeSeries("", nil, tp{
+				time.Unix(1, 0), nil,
+			}, tp{
+				time.Unix(2, 0), float64Pointer(20),
+			})}},
+		},
+		{
+			name: "number condition chooses per label union",
+			expr: "$Up ? $Load : -1",
+			results: Results{[]Value{
+				makeSeries("host=a", data.Labels{"host": "a"}, tp{
+					time.Unix(0, 0), float64Pointer(5),
+				}),
+				makeSeries("host=b", data.Labels{"host": "b"}, tp{
+					time.Unix(0, 0), float64Pointer(-1),
+				}),
+			}},
+		},
+		{
+			name: "number arguments give numbers",
+			expr: "$Up ? 1 : $Up - 1",
+			results: Results{[]Value{
+				makeNumber("host=a", data.Labels{"host": "a"}, float64Pointer(1)),
+				makeNumber("host=b", data.Labels{"host": "b"}, float64Pointer(-1)),
+			}},
+		},
+		{
+			name: "function argument",
+			expr: "abs($Up ? -2 : 3)",
+			results: Results{[]Value{
+				makeNumber("", data.Labels{"host": "a"}, float64Pointer(2)),
+				makeNumber("", data.Labels{"host": "b"}, float64Pointer(3)),
+			}},
+		},
+	}
+	opt := cmp.Comparer(func(x, y float64) bool {
+		return (math.IsNaN(x) && math.IsNaN(y)) || x == y
+	})
+	options := append([]cmp.Option{opt}, data.FrameTestCompareOptions()...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			res, err := e.ExecuteWithOptions(vars, Options{NullMode: tt.nullMode})
+			assert.NoError(t, err)
+			if diff := cmp.Diff(tt.results, res, options...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTernaryDroppedUnions(t *testing.T) {
+	vars := Vars{
+		"Cond": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "a"}, float64Pointer(1)),
+				makeNumber("", data.Labels{"host": "c"}, float64Pointer(1)),
+			},
+		},
+		"Load": Results{
+			[]Value{
+				makeNumber("", data.Labels{"host": "a"}, float64Pointer(5)),
+				makeNumber("", data.Labels{"host": "b"}, float64Pointer(6)),
+			},
+		},
+	}
+	e, err := New("$Cond ? $Load : -1")
+	assert.NoError(t, err)
+	res, notices, err := e.ExecuteWithNotices(vars, Options{})
+	assert.NoError(t, err)
+	assert.Len(t, res.Values, 1)
+	// host=c of the condition and host=b of the arguments are left without a match.
+	assert.Equal(t, []data.Notice{{
+		Severity: data.NoticeSeverityWarning,
+		Text:     "3 combination(s) of results in $Cond ? $Load : -1 were dropped because their labels do not match, e.g. {host=c} and {host=a}",
+	}}, notices)
+}
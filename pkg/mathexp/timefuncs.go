@@ -0,0 +1,159 @@
+package mathexp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// mapTimes returns a Series with the times of s, where the value of each point is
+// timeF of its time in loc. The values of s are not used, so points with null values
+// have a value too. Points with null times are dropped.
+func (s Series) mapTimes(loc *time.Location, timeF func(t time.Time) float64) Series {
+	if loc == nil {
+		loc = time.UTC
+	}
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, s.ValueIsNullabe, 0)
+	for i := 0; i < s.Len(); i++ {
+		t, _ := s.GetPoint(i)
+		if t == nil {
+			continue
+		}
+		f := timeF(t.In(loc))
+		newSeries.AppendPoint(newSeries.Len(), t, &f)
+	}
+	return newSeries
+}
+
+// Age returns a Number with the labels of s that is the time in seconds from the
+// last point of s with a value that is not null or NaN to now. The Number is null
+// if s has no such point.
+func (s Series) Age(now time.Time) Number {
+	var l data.Labels
+	if s.GetLabels() != nil {
+		l = s.GetLabels().Copy()
+	}
+	number := NewNumber(fmt.Sprintf("age_%v", s.GetName()), l)
+	var last *time.Time
+	for i := 0; i < s.Len(); i++ {
+		t, f := s.GetPoint(i)
+		if t != nil && !missing(f) && (last == nil || t.After(*last)) {
+			last = t
+		}
+	}
+	if last != nil {
+		age := now.Sub(*last).Seconds()
+		number.SetValue(&age)
+	}
+	return number
+}
+
+// unixSeconds returns t as seconds since the Unix epoch.
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// weekdays are the day names accepted by ParseTimeMask.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// TimeMask is a recurring weekly window of time, such as business hours
+// or a maintenance window.
+type TimeMask struct {
+	// Days are the days of the week, indexed by time.Weekday, on which the window starts.
+	Days [7]bool
+	// From and To are the start and end of the window as the time since midnight.
+	// If To is not after From the window ends on the next day.
+	From, To time.Duration
+}
+
+// ParseTimeMask parses the days and hours of a TimeMask. days is a comma separated
+// list of days or ranges of days such as "Mon-Fri" or "Sat,Sun", and hours is a range
+// of times such as "09:00-17:00" that includes the start but not the end. A range of
+// hours such as "22:00-02:00" ends on the next day.
+func ParseTimeMask(days, hours string) (TimeMask, error) {
+	var m TimeMask
+	for _, part := range strings.Split(days, ",") {
+		bounds := strings.Split(strings.TrimSpace(part), "-")
+		if len(bounds) > 2 {
+			return m, fmt.Errorf("invalid days %q", days)
+		}
+		first, ok := weekdays[strings.ToLower(strings.TrimSpace(bounds[0]))]
+		if !ok {
+			return m, fmt.Errorf("invalid day %q in %q", bounds[0], days)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[strings.ToLower(strings.TrimSpace(bounds[1]))]; !ok {
+				return m, fmt.Errorf("invalid day %q in %q", bounds[1], days)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			m.Days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+
+	bounds := strings.Split(hours, "-")
+	if len(bounds) != 2 {
+		return m, fmt.Errorf("invalid hours %q, expected a range such as 09:00-17:00", hours)
+	}
+	var err error
+	if m.From, err = parseTimeOfDay(bounds[0]); err != nil {
+		return m, err
+	}
+	if m.To, err = parseTimeOfDay(bounds[1]); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// parseTimeOfDay parses a time of day such as "09:30" as the time since midnight.
+// "24:00" is the end of the day.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected hours and minutes such as 09:30", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains returns true if t, in its location, is within the window. The window is
+// in wall clock time, so it does not move on days with a daylight saving change.
+func (m TimeMask) Contains(t time.Time) bool {
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	day := t.Weekday()
+	if m.From < m.To {
+		return m.Days[day] && sinceMidnight >= m.From && sinceMidnight < m.To
+	}
+	// The window ends on the next day, so t may be in the window that started the day before.
+	prevDay := (day + 6) % 7
+	return (m.Days[day] && sinceMidnight >= m.From) || (m.Days[prevDay] && sinceMidnight < m.To)
+}
+
+// TimeMask returns a Series with the times of s where the value is 1 if the time,
+// in loc, is within the window of m, and 0 otherwise.
+func (s Series) TimeMask(m TimeMask, loc *time.Location) Series {
+	return s.mapTimes(loc, func(t time.Time) float64 {
+		if m.Contains(t) {
+			return 1
+		}
+		return 0
+	})
+}
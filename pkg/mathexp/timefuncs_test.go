@@ -0,0 +1,232 @@
+package mathexp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeFuncs(t *testing.T) {
+	// Friday 2020-01-03 08:30 UTC, Friday 16:30 UTC and Saturday 10:00 UTC.
+	fri0830 := time.Date(2020, 1, 3, 8, 30, 0, 0, time.UTC)
+	fri1630 := time.Date(2020, 1, 3, 16, 30, 0, 0, time.UTC)
+	sat1000 := time.Date(2020, 1, 4, 10, 0, 0, 0, time.UTC)
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeSeries("", data.Labels{"host": "a"}, tp{
+					fri0830, float64Pointer(1),
+				}, tp{
+					fri1630, nil,
+				}, tp{
+					sat1000, float64Pointer(3),
+				}),
+			},
+		},
+	}
+	vars["B"] = Results{
+		[]Value{
+			makeSeries("", data.Labels{"host": "b"}, tp{
+				fri0830, float64Pointer(1),
+			}, tp{
+				sat1000, nil,
+			}),
+			makeSeries("", data.Labels{"host": "c"}, tp{
+				fri0830, nil,
+			}),
+		},
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := func(f0, f1, f2 float64) Results {
+		return Results{[]Value{makeSeries("", data.Labels{"host": "a"}, tp{
+			fri0830, float64Pointer(f0),
+		}, tp{
+			fri1630, float64Pointer(f1),
+		}, tp{
+			sat1000, float64Pointer(f2),
+		})}}
+	}
+	var tests = []struct {
+		name      string
+		expr      string
+		location  *time.Location
+		execErrIs assert.ErrorAssertionFunc
+		results   Results
+	}{
+		{
+			name:      "timestamp",
+			expr:      "timestamp($A)",
+			execErrIs: assert.NoError,
+			results:   expected(float64(fri0830.Unix()), float64(fri1630.Unix()), float64(sat1000.Unix())),
+		},
+		{
+			name:      "age of points",
+			expr:      "time() - timestamp($A)",
+			execErrIs: assert.NoError,
+			results: Results{[]Value{makeSeries("host=a", data.Labels{"host": "a"}, tp{
+				fri0830, float64Pointer(91800),
+			}, tp{
+				fri1630, float64Pointer(63000),
+			}, tp{
+				sat1000, float64Pointer(0),
+			})}},
+		},
+		{
+			name:      "age of last point",
+			expr:      "age($A)",
+			execErrIs: assert.NoError,
+			results:   Results{[]Value{makeNumber("age_", data.Labels{"host": "a"}, float64Pointer(0))}},
+		},
+		{
+			name:      "age of last non-null point",
+			expr:      "age($B)",
+			execErrIs: assert.NoError,
+			results: Results{[]Value{
+				makeNumber("age_", data.Labels{"host": "b"}, float64Pointer(91800)),
+				makeNumber("age_", data.Labels{"host": "c"}, nil),
+			}},
+		},
+		{
+			name:      "hour",
+			expr:      "hour($A)",
+			execErrIs: assert.NoError,
+			results:   expected(8, 16, 10),
+		},
+		{
+			name:      "hour in timezone",
+			expr:      "hour($A)",
+			location:  tokyo,
+			execErrIs: assert.NoError,
+			results:   expected(17, 1, 19),
+		},
+		{
+			name:      "day_of_week",
+			expr:      "day_of_week($A)",
+			execErrIs: assert.NoError,
+			results:   expected(5, 5, 6),
+		},
+		{
+			name:      "day_of_week in timezone",
+			expr:      "day_of_week($A)",
+			location:  tokyo,
+			execErrIs: assert.NoError,
+			results:   expected(5, 6, 6),
+		},
+		{
+			name:      "day_of_month",
+			expr:      "day_of_month($A)",
+			execErrIs: assert.NoError,
+			results:   expected(3, 3, 4),
+		},
+		{
+			name:      "business_hours",
+			expr:      "business_hours($A)",
+			execErrIs: assert.NoError,
+			results:   expected(0, 1, 0),
+		},
+		{
+			name:      "business_hours in timezone",
+			expr:      "business_hours($A)",
+			location:  tokyo,
+			execErrIs: assert.NoError,
+			results:   expected(0, 0, 0),
+		},
+		{
+			name:      "time_mask",
+			expr:      `time_mask($A, "Sat,Sun", "09:00-11:00")`,
+			execErrIs: assert.NoError,
+			results:   expected(0, 0, 1),
+		},
+		{
+			name:      "time_mask invalid",
+			expr:      `time_mask($A, "Funday", "09:00-11:00")`,
+			execErrIs: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			res, err := e.ExecuteWithOptions(vars, Options{Location: tt.location, Now: sat1000})
+			tt.execErrIs(t, err)
+			if tt.results.Values == nil {
+				return
+			}
+			if diff := cmp.Diff(tt.results, res, data.FrameTestCompareOptions()...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTimeMask(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name  string
+		days  string
+		hours string
+		errIs assert.ErrorAssertionFunc
+		in    []time.Time
+		out   []time.Time
+	}{
+		{
+			name:  "business hours",
+			days:  "Mon-Fri",
+			hours: "09:00-17:00",
+			errIs: assert.NoError,
+			in:    []time.Time{time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC), time.Date(2020, 1, 10, 16, 59, 0, 0, time.UTC)},
+			out:   []time.Time{time.Date(2020, 1, 6, 17, 0, 0, 0, time.UTC), time.Date(2020, 1, 5, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "overnight window ends the next day",
+			days:  "Sun",
+			hours: "22:00-02:00",
+			errIs: assert.NoError,
+			in:    []time.Time{time.Date(2020, 1, 5, 23, 0, 0, 0, time.UTC), time.Date(2020, 1, 6, 1, 0, 0, 0, time.UTC)},
+			out:   []time.Time{time.Date(2020, 1, 5, 1, 0, 0, 0, time.UTC), time.Date(2020, 1, 6, 23, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "day range wraps around the week",
+			days:  "fri-mon",
+			hours: "00:00-24:00",
+			errIs: assert.NoError,
+			in:    []time.Time{time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 6, 23, 59, 0, 0, time.UTC)},
+			out:   []time.Time{time.Date(2020, 1, 7, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)},
+		},
+		{
+			// Clocks went forward an hour at 02:00 on Sunday 2020-03-08 in New York.
+			name:  "wall clock hours on a daylight saving change",
+			days:  "Sun",
+			hours: "09:00-17:00",
+			errIs: assert.NoError,
+			in:    []time.Time{time.Date(2020, 3, 8, 9, 0, 0, 0, newYork), time.Date(2020, 3, 8, 16, 59, 0, 0, newYork)},
+			out:   []time.Time{time.Date(2020, 3, 8, 8, 59, 0, 0, newYork), time.Date(2020, 3, 8, 17, 0, 0, 0, newYork)},
+		},
+		{name: "invalid day", days: "Mon-Xyz", hours: "09:00-17:00", errIs: assert.Error},
+		{name: "invalid hours", days: "Mon", hours: "9-17", errIs: assert.Error},
+		{name: "missing end", days: "Mon", hours: "09:00", errIs: assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ParseTimeMask(tt.days, tt.hours)
+			tt.errIs(t, err)
+			for _, in := range tt.in {
+				assert.True(t, m.Contains(in), "expected %v in mask", in)
+			}
+			for _, out := range tt.out {
+				assert.False(t, m.Contains(out), "expected %v not in mask", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package mathexp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// dayWeekRe matches the day and week units of a duration, such as "1w" or "1.5d".
+var dayWeekRe = regexp.MustCompile(`(\d+(?:\.\d*)?|\.\d+)([dw])`)
+
+// ParseDuration parses a duration like time.ParseDuration, but also accepts the
+// units "d" for 24 hours and "w" for 7 days, e.g. "1w", "2d" or "1d12h".
+func ParseDuration(s string) (time.Duration, error) {
+	var convErr error
+	hours := dayWeekRe.ReplaceAllStringFunc(s, func(m string) string {
+		match := dayWeekRe.FindStringSubmatch(m)
+		f, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			convErr = err
+			return m
+		}
+		if match[2] == "w" {
+			f *= 7
+		}
+		return strconv.FormatFloat(f*24, 'f', -1, 64) + "h"
+	})
+	if convErr != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", s, convErr)
+	}
+	d, err := time.ParseDuration(hours)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+// TimeShift returns a Series with the points of s moved forward in time by d.
+// A negative d moves the points back in time. The names and labels of the
+// fields of s are kept.
+func (s Series) TimeShift(d time.Duration) Series {
+	newSeries := s.emptyCopy()
+	newSeries.Frame.Extend(s.Len())
+	for i := 0; i < s.Len(); i++ {
+		t, f := s.GetPoint(i)
+		if t != nil {
+			shifted := t.Add(d)
+			t = &shifted
+		}
+		newSeries.SetPoint(i, t, f)
+	}
+	return newSeries
+}
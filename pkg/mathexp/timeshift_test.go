@@ -0,0 +1,97 @@
+package mathexp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDuration(t *testing.T) {
+	var tests = []struct {
+		input    string
+		errIs    assert.ErrorAssertionFunc
+		duration time.Duration
+	}{
+		{"10m", assert.NoError, 10 * time.Minute},
+		{"1d", assert.NoError, 24 * time.Hour},
+		{"1w", assert.NoError, 7 * 24 * time.Hour},
+		{"1.5d", assert.NoError, 36 * time.Hour},
+		{"1d12h30m", assert.NoError, 36*time.Hour + 30*time.Minute},
+		{"-1w", assert.NoError, -7 * 24 * time.Hour},
+		{"500ms", assert.NoError, 500 * time.Millisecond},
+		{"1x", assert.Error, 0},
+		{"d", assert.Error, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			d, err := ParseDuration(tt.input)
+			tt.errIs(t, err)
+			assert.Equal(t, tt.duration, d)
+		})
+	}
+}
+
+func TestTimeShift(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeSeries("", data.Labels{"host": "a"}, tp{
+					time.Unix(0, 0), float64Pointer(1),
+				}, tp{
+					time.Unix(60, 0), nil,
+				}),
+			},
+		},
+	}
+	var tests = []struct {
+		name      string
+		expr      string
+		execErrIs assert.ErrorAssertionFunc
+		results   Results
+	}{
+		{
+			name:      "forward by days",
+			expr:      `timeshift($A, "1d")`,
+			execErrIs: assert.NoError,
+			results: Results{[]Value{makeSeries("", data.Labels{"host": "a"}, tp{
+				time.Unix(86400, 0), float64Pointer(1),
+			}, tp{
+				time.Unix(86460, 0), nil,
+			})}},
+		},
+		{
+			name:      "back by minutes",
+			expr:      `timeshift($A, "-1m")`,
+			execErrIs: assert.NoError,
+			results: Results{[]Value{makeSeries("", data.Labels{"host": "a"}, tp{
+				time.Unix(-60, 0), float64Pointer(1),
+			}, tp{
+				time.Unix(0, 0), nil,
+			})}},
+		},
+		{
+			name:      "invalid duration",
+			expr:      `timeshift($A, "1 week")`,
+			execErrIs: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			res, err := e.Execute(vars)
+			tt.execErrIs(t, err)
+			if tt.results.Values == nil {
+				return
+			}
+			if diff := cmp.Diff(tt.results, res, data.FrameTestCompareOptions()...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package mathexp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// OtherLabel is the label of the value made by Other from the values not selected by TopK.
+const OtherLabel = "__other__"
+
+// TopK returns the k values of r with the greatest rank, and the rest of the values.
+// If bottom is true the values with the least rank are selected instead.
+//
+// The rank of a Series is its reduction by the reducer, which can be any reduction
+// function of Reduce, with null values handled according to the NullMode. The rank of a
+// Number or Scalar is its value and the reducer is not used. Values with a null or NaN
+// rank are selected last. The selected values are in order of rank, and values with the
+// same rank keep their order in r. The rest of the values keep their order in r.
+func (r Results) TopK(k int, reducer string, bottom bool, nullMode NullMode) (selected, rest Results, err error) {
+	if k < 0 {
+		return selected, rest, fmt.Errorf("k must not be negative, got %v", k)
+	}
+	ranks := make([]float64, len(r.Values))
+	for i, val := range r.Values {
+		var f *float64
+		switch v := val.(type) {
+		case Series:
+			n, err := v.ReduceWithNullMode(reducer, nullMode)
+			if err != nil {
+				return selected, rest, err
+			}
+			f = n.GetFloat64Value()
+		case Number:
+			f = v.GetFloat64Value()
+		case Scalar:
+			f = v.GetFloat64Value()
+		default:
+			return selected, rest, fmt.Errorf("can not rank type %v", val.Type())
+		}
+		ranks[i] = math.NaN()
+		if f != nil {
+			ranks[i] = *f
+		}
+	}
+
+	order := make([]int, len(r.Values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := ranks[order[i]], ranks[order[j]]
+		if math.IsNaN(b) {
+			return !math.IsNaN(a)
+		}
+		if math.IsNaN(a) {
+			return false
+		}
+		if bottom {
+			return a < b
+		}
+		return a > b
+	})
+
+	if k > len(order) {
+		k = len(order)
+	}
+	isSelected := make([]bool, len(r.Values))
+	selected = Results{Values: make(Values, 0, k)}
+	for _, i := range order[:k] {
+		isSelected[i] = true
+		selected.Values = append(selected.Values, r.Values[i])
+	}
+	rest = Results{Values: Values{}}
+	for i, val := range r.Values {
+		if !isSelected[i] {
+			rest.Values = append(rest.Values, val)
+		}
+	}
+	return selected, rest, nil
+}
+
+// Other returns a single value that aggregates the values of r with the Aggregator,
+// such as the values not selected by TopK, with the label OtherLabel="true". The
+// result is empty if r is empty.
+func (r Results) Other(agg Aggregator, nullMode NullMode) (Results, error) {
+	res, err := r.AggregateWithNullMode(agg, Grouping{}, nullMode)
+	if err != nil {
+		return res, err
+	}
+	for _, val := range res.Values {
+		val.SetLabels(data.Labels{OtherLabel: "true"})
+	}
+	return res, nil
+}
@@ -0,0 +1,154 @@
+package mathexp
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopKFuncs(t *testing.T) {
+	// series returns a series for the host with points every 10 seconds from 0.
+	series := func(host string, fs ...*float64) Series {
+		points := make([]tp, len(fs))
+		for i, f := range fs {
+			points[i] = tp{time.Unix(int64(i*10), 0), f}
+		}
+		return makeSeries("", data.Labels{"host": host}, points...)
+	}
+	a := series("a", float64Pointer(1), float64Pointer(3))
+	b := series("b", float64Pointer(10), float64Pointer(0))
+	c := series("c", float64Pointer(4), float64Pointer(4))
+	d := series("d", nil, nil)
+	numA := makeNumber("", data.Labels{"host": "a"}, float64Pointer(2))
+	numB := makeNumber("", data.Labels{"host": "b"}, float64Pointer(math.NaN()))
+	numC := makeNumber("", data.Labels{"host": "c"}, float64Pointer(5))
+	vars := Vars{
+		"A": Results{[]Value{a, b, c, d}},
+		"N": Results{[]Value{numA, numB, numC}},
+	}
+	var tests = []struct {
+		name      string
+		expr      string
+		execErrIs assert.ErrorAssertionFunc
+		results   Results
+	}{
+		{
+			name:      "topk by mean",
+			expr:      `topk(2, $A, "mean")`,
+			execErrIs: assert.NoError,
+			results:   Results{[]Value{b, c}},
+		},
+		{
+			name:      "bottomk by mean",
+			expr:      `bottomk(2, $A, "mean")`,
+			execErrIs: assert.NoError,
+			results:   Results{[]Value{a, c}},
+		},
+		{
+			name:      "topk by max",
+			expr:      `topk(1, $A, "max")`,
+			execErrIs: assert.NoError,
+			results:   Results{[]Value{b}},
+		},
+		{
+			name:      "topk with null rank last",
+			expr:      `topk(5, $A, "last")`,
+			execErrIs: assert.NoError,
+			results:   Results{[]Value{c, a, b, d}},
+		},
+		{
+			name:      "topk of numbers with NaN last",
+			expr:      `topk(3, $N, "mean")`,
+			execErrIs: assert.NoError,
+			results:   Results{[]Value{numC, numA, numB}},
+		},
+		{
+			name:      "bottomk of numbers",
+			expr:      `bottomk(1, $N, "mean")`,
+			execErrIs: assert.NoError,
+			results:   Results{[]Value{numA}},
+		},
+		{
+			name:      "topk of zero",
+			expr:      `topk(0, $A, "mean")`,
+			execErrIs: assert.NoError,
+			results:   Results{[]Value{}},
+		},
+		{
+			name:      "topk of a huge k",
+			expr:      `topk(1e300, $N, "mean")`,
+			execErrIs: assert.NoError,
+			results:   Results{[]Value{numC, numA, numB}},
+		},
+		{
+			name:      "topk_other",
+			expr:      `topk_other(1, $N, "mean", "sum")`,
+			execErrIs: assert.NoError,
+			results: Results{[]Value{
+				numC,
+				makeNumber("sum", data.Labels{OtherLabel: "true"}, float64Pointer(math.NaN())),
+			}},
+		},
+		{
+			name:      "bottomk_other with nothing left",
+			expr:      `bottomk_other(3, $N, "mean", "sum")`,
+			execErrIs: assert.NoError,
+			results:   Results{[]Value{numA, numC, numB}},
+		},
+		{
+			name:      "topk_other invalid aggregator",
+			expr:      `topk_other(1, $N, "mean", "foo")`,
+			execErrIs: assert.Error,
+		},
+		{
+			name:      "topk invalid k",
+			expr:      `topk(1.5, $A, "mean")`,
+			execErrIs: assert.Error,
+		},
+		{
+			name:      "topk invalid reducer",
+			expr:      `topk(1, $A, "foo")`,
+			execErrIs: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			if !assert.NoError(t, err) {
+				return
+			}
+			res, err := e.Execute(vars)
+			tt.execErrIs(t, err)
+			if tt.results.Values == nil {
+				return
+			}
+			if diff := cmp.Diff(tt.results, res, data.FrameTestCompareOptions()...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTopKOther(t *testing.T) {
+	res := Results{[]Value{
+		makeNumber("", data.Labels{"host": "a"}, float64Pointer(1)),
+		makeNumber("", data.Labels{"host": "b"}, float64Pointer(7)),
+		makeNumber("", data.Labels{"host": "c"}, float64Pointer(2)),
+	}}
+	selected, rest, err := res.TopK(1, "mean", false, NullModeSkip)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, Values{res.Values[1]}, selected.Values)
+	assert.Equal(t, Values{res.Values[0], res.Values[2]}, rest.Values)
+
+	other, err := rest.Other(Aggregator{Name: "sum"}, NullModeSkip)
+	if assert.NoError(t, err) && assert.Len(t, other.Values, 1) {
+		assert.Equal(t, data.Labels{OtherLabel: "true"}, other.Values[0].GetLabels())
+		assert.Equal(t, float64Pointer(3), other.Values[0].(Number).GetFloat64Value())
+	}
+}
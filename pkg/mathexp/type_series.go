@@ -83,6 +83,33 @@ func NewSeries(name string, labels data.Labels, timeIdx int, nullableTime bool,
 	}
 }
 
+// emptyCopy returns a Series with no points and the same frame name, field names
+// and labels as s.
+func (s Series) emptyCopy() Series {
+	newSeries := s
+	newSeries.Frame = s.Frame.EmptyCopy()
+	for i, field := range s.Frame.Fields {
+		if field.Labels == nil {
+			// EmptyCopy makes empty labels from nil labels.
+			newSeries.Frame.Fields[i].Labels = nil
+		}
+	}
+	return newSeries
+}
+
+// Between returns a Series with the points of s that have a time after from and
+// at or before to. Points with null times are dropped.
+func (s Series) Between(from, to time.Time) Series {
+	newSeries := s.emptyCopy()
+	for i := 0; i < s.Len(); i++ {
+		t, f := s.GetPoint(i)
+		if t != nil && t.After(from) && !t.After(to) {
+			newSeries.AppendPoint(newSeries.Len(), t, f)
+		}
+	}
+	return newSeries
+}
+
 // Type returns the Value type and allows it to fulfill the Value interface.
 func (s Series) Type() parse.ReturnType { return parse.TypeSeriesSet }
 
@@ -237,8 +237,76 @@ func Test_union(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			unions := union(tt.aResults, tt.bResults)
+			unions, _ := union(tt.aResults, tt.bResults)
 			tt.unionsAre(t, tt.unions, unions)
 		})
 	}
 }
+
+func Test_unionDropped(t *testing.T) {
+	aResults := Results{
+		Values: Values{
+			makeNumber("a", data.Labels{"id": "1"}, float64Pointer(1)),
+			makeNumber("aa", data.Labels{"id": "2"}, float64Pointer(2)),
+		},
+	}
+	bResults := Results{
+		Values: Values{
+			makeNumber("b", data.Labels{"id": "1"}, float64Pointer(3)),
+		},
+	}
+	unions, dropped := union(aResults, bResults)
+	assert.Len(t, unions, 1)
+	assert.Equal(t, []DroppedUnion{{ALabels: data.Labels{"id": "2"}, BLabels: data.Labels{"id": "1"}}}, dropped)
+
+	// The single value fallback joins the values, so nothing is dropped.
+	unions, dropped = union(Results{Values: aResults.Values[1:]}, bResults)
+	assert.Len(t, unions, 1)
+	assert.Empty(t, dropped)
+}
+
+func TestDroppedUnionsNotice(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			Values: Values{
+				makeNumber("a", data.Labels{"id": "1"}, float64Pointer(1)),
+				makeNumber("aa", data.Labels{"id": "2"}, float64Pointer(2)),
+			},
+		},
+		"B": Results{
+			Values: Values{
+				makeNumber("b", data.Labels{"id": "1"}, float64Pointer(3)),
+				makeNumber("bb", data.Labels{"id": "3"}, float64Pointer(4)),
+			},
+		},
+	}
+	e, err := New("$A + $B")
+	assert.NoError(t, err)
+	res, notices, err := e.ExecuteWithNotices(vars, Options{})
+	assert.NoError(t, err)
+	assert.Len(t, res.Values, 1)
+	assert.Equal(t, []data.Notice{{
+		Severity: data.NoticeSeverityWarning,
+		Text:     "3 combination(s) of results in $A + $B were dropped because their labels do not match, e.g. {id=1} and {id=3}",
+	}}, notices)
+	assert.Nil(t, res.Values[0].AsDataFrame().Meta, "frames are not modified")
+
+	// The notice is kept when every combination is dropped.
+	vars["C"] = Results{Values{makeNumber("c", data.Labels{"id": "4"}, float64Pointer(5))}}
+	e, err = New("$B + $C")
+	assert.NoError(t, err)
+	res, notices, err = e.ExecuteWithNotices(vars, Options{})
+	assert.NoError(t, err)
+	assert.Empty(t, res.Values)
+	assert.Equal(t, []data.Notice{{
+		Severity: data.NoticeSeverityWarning,
+		Text:     "2 combination(s) of results in $B + $C were dropped because their labels do not match, e.g. {id=1} and {id=4}",
+	}}, notices)
+
+	// Results without dropped unions have no notices.
+	e, err = New("$A * 2")
+	assert.NoError(t, err)
+	_, notices, err = e.ExecuteWithNotices(vars, Options{})
+	assert.NoError(t, err)
+	assert.Nil(t, notices)
+}
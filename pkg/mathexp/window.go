@@ -0,0 +1,84 @@
+package mathexp
+
+// MovingWindow returns a Series where each point is the aggregation of the values of s
+// in the trailing window that ends at that point. A window of points has that point and
+// the points before it, and a duration window has the points within the duration up to
+// and including that point. Windows at the start of the series may be partial.
+//
+// Null values are ignored. If a window has no values the point is null. Points are
+// sorted by time and points with null times are dropped.
+func (s Series) MovingWindow(w Window, agg Aggregator) Series {
+	points := sortedPoints(s)
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, true, 0)
+	start := 0
+	for i, p := range points {
+		p := p
+		if w.Points > 0 {
+			if i-start+1 > w.Points {
+				start = i - w.Points + 1
+			}
+		} else {
+			for p.t.Sub(points[start].t) >= w.Duration {
+				start++
+			}
+		}
+		vals := make([]float64, 0, i-start+1)
+		for _, wp := range points[start : i+1] {
+			if wp.f != nil {
+				vals = append(vals, *wp.f)
+			}
+		}
+		var f *float64
+		if len(vals) > 0 {
+			aggF := agg.aggregate(vals)
+			f = &aggF
+		}
+		newSeries.AppendPoint(i, &p.t, f)
+	}
+	return newSeries
+}
+
+// EWMA returns the exponentially weighted moving average of s with the smoothing
+// factor alpha, which must be in (0, 1]. The average starts at the first value, and
+// each following value v updates the average to alpha*v + (1-alpha)*average.
+//
+// Null values do not update the average, so the point has the previous average,
+// or null if there is no previous value. Points are sorted by time and points with
+// null times are dropped.
+func (s Series) EWMA(alpha float64) Series {
+	return s.running(func(avg *float64, v float64) float64 {
+		if avg == nil {
+			return v
+		}
+		return alpha*v + (1-alpha)*(*avg)
+	})
+}
+
+// CumSum returns the cumulative sum of the values of s. Null values do not add to the
+// sum, so the point has the previous sum, or null if there is no previous value. Points
+// are sorted by time and points with null times are dropped.
+func (s Series) CumSum() Series {
+	return s.running(func(sum *float64, v float64) float64 {
+		if sum == nil {
+			return v
+		}
+		return *sum + v
+	})
+}
+
+// running returns a Series where each point is the accumulation of the non-null
+// values of s up to that point. next returns the accumulation of acc, which is nil
+// for the first value, and the value v.
+func (s Series) running(next func(acc *float64, v float64) float64) Series {
+	newSeries := NewSeries(s.GetName(), s.GetLabels(), s.TimeIdx, s.TimeIsNullable, s.ValueIdx, true, 0)
+	var acc *float64
+	for i, p := range sortedPoints(s) {
+		p := p
+		if p.f != nil {
+			f := next(acc, *p.f)
+			acc = &f
+		}
+		newSeries.AppendPoint(i, &p.t, acc)
+	}
+	return newSeries
+}
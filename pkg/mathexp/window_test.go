@@ -0,0 +1,64 @@
+package mathexp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowFuncs(t *testing.T) {
+	vars := Vars{
+		"A": Results{
+			[]Value{
+				makeSeries("", data.Labels{"host": "a"}, tp{
+					time.Unix(0, 0), float64Pointer(1),
+				}, tp{
+					time.Unix(10, 0), float64Pointer(3),
+				}, tp{
+					time.Unix(20, 0), nil,
+				}, tp{
+					time.Unix(30, 0), float64Pointer(5),
+				}, tp{
+					time.Unix(40, 0), float64Pointer(7),
+				}),
+			},
+		},
+	}
+	expected := func(fs ...float64) Results {
+		points := make([]tp, len(fs))
+		for i, f := range fs {
+			points[i] = tp{time.Unix(int64(i*10), 0), float64Pointer(f)}
+		}
+		return Results{[]Value{makeSeries("", data.Labels{"host": "a"}, points...)}}
+	}
+	var tests = []struct {
+		name      string
+		expr      string
+		execErrIs assert.ErrorAssertionFunc
+		results   Results
+	}{
+		{"moving average over points", `moving_avg($A, "2")`, assert.NoError, expected(1, 2, 3, 5, 6)},
+		{"moving sum over a duration", `moving_sum($A, "20s")`, assert.NoError, expected(1, 4, 3, 5, 12)},
+		{"moving min", `moving_min($A, "3")`, assert.NoError, expected(1, 1, 1, 3, 5)},
+		{"moving max", `moving_max($A, "3")`, assert.NoError, expected(1, 3, 3, 5, 7)},
+		{"moving median", `moving_median($A, "3")`, assert.NoError, expected(1, 2, 2, 4, 6)},
+		{"ewma", `ewma($A, 0.5)`, assert.NoError, expected(1, 2, 2, 3.5, 5.25)},
+		{"cumsum", `cumsum($A)`, assert.NoError, expected(1, 4, 4, 9, 16)},
+		{"invalid window", `moving_avg($A, "x")`, assert.Error, Results{}},
+		{"invalid ewma alpha", `ewma($A, 2)`, assert.Error, Results{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := New(tt.expr)
+			assert.NoError(t, err)
+			res, err := e.Execute(vars)
+			tt.execErrIs(t, err)
+			if diff := cmp.Diff(tt.results, res, data.FrameTestCompareOptions()...); diff != "" {
+				t.Errorf("Result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -27,8 +27,19 @@ func (gp *GELPlugin) TransformData(ctx context.Context, req *backend.QueryDataRe
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	// A request can ask for the pipeline to be evaluated at every step of a range.
+	rangeOpts, err := gelpoc.RangeOptionsFromQueries(req.Queries)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	// Execute the pipeline
-	responses, err := svc.ExecutePipeline(ctx, pipeline)
+	var responses *backend.QueryDataResponse
+	if rangeOpts != nil {
+		responses, err = svc.ExecutePipelineRange(ctx, pipeline, *rangeOpts)
+	} else {
+		responses, err = svc.ExecutePipeline(ctx, pipeline)
+	}
 	if err != nil {
 		return nil, status.Error(codes.Unknown, err.Error())
 	}